@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// exit codes of Nagios and Icinga plugins, check exits with them instead of the usual exit codes
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+var CheckStatus = [...]string{
+	"OK",
+	"WARNING",
+	"CRITICAL",
+	"UNKNOWN",
+}
+
+// evaluateCheck decides the check's status by the expectations of the service and describes it in a single line with perfdata
+func evaluateCheck(service Service, result Result, err error) (int, string) {
+
+	if err != nil {
+
+		code := CheckUnknown
+		if errors.Is(err, ErrServiceNotFound) {
+			code = CheckCritical
+		}
+
+		// a failed action also carries the status output and logs, monitoring only shows the first line
+		return code, checkLine(code, strings.SplitN(err.Error(), "\n", 2)[0], "")
+	}
+
+	if len(result.Records) == 0 {
+		return CheckUnknown, checkLine(CheckUnknown, fmt.Sprintf("no status of service %s", service.name), "")
+	}
+
+	record := result.Records[0]
+	uptime := time.Duration(record.Uptime) * time.Second
+	message := describeRecord(record)
+
+	code := CheckOK
+	state := ServiceState{Status: statusByName(record.State)}
+
+	// a disabled or failed service counts as stopped, as it does for ensure-stopped
+	switch {
+	case state.Is(statusByName(service.expect)):
+	case state.Status == ServiceStatusUnknown:
+		code = CheckUnknown
+	case state.Status == ServiceStatusStarting, state.Status == ServiceStatusStopping,
+		state.Status == ServiceStatusPausing, state.Status == ServiceStatusResuming:
+		code = CheckWarning
+	default:
+		code = CheckCritical
+	}
+
+	if code != CheckOK {
+		message = fmt.Sprintf("%s, expected %s", message, service.expect)
+	}
+
+	// a service that runs but started recently may be restarting over and over
+	if code == CheckOK && record.Uptime > 0 {
+
+		if service.critUptime > 0 && uptime < service.critUptime {
+			code = CheckCritical
+		} else if service.warnUptime > 0 && uptime < service.warnUptime {
+			code = CheckWarning
+		}
+
+		if code != CheckOK {
+			message = fmt.Sprintf("%s, restarted %s ago", message, uptime)
+		}
+	}
+
+	perfdata := fmt.Sprintf("time=%.3fs;;;0 uptime=%ds;%s;%s;0", record.Duration, record.Uptime,
+		uptimeThreshold(service.warnUptime), uptimeThreshold(service.critUptime))
+
+	return code, checkLine(code, message, perfdata)
+}
+
+// describeRecord tells the state of the record's service like the status action does
+func describeRecord(record Record) string {
+
+	details := []string{}
+
+	if record.SubState != "" {
+		details = append(details, record.SubState)
+	}
+
+	if record.PID > 0 {
+		details = append(details, fmt.Sprintf("pid %d", record.PID))
+	}
+
+	if record.Uptime > 0 {
+		details = append(details, fmt.Sprintf("up %s", time.Duration(record.Uptime)*time.Second))
+	}
+
+	message := fmt.Sprintf("service %s is %s", record.Service, record.State)
+
+	if len(details) > 0 {
+		message = fmt.Sprintf("%s (%s)", message, strings.Join(details, ", "))
+	}
+
+	return message
+}
+
+// uptimeThreshold is the perfdata range of an uptime threshold, the check alerts below it
+func uptimeThreshold(threshold time.Duration) string {
+
+	if threshold <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:", int64(threshold.Seconds()))
+}
+
+func checkLine(code int, message string, perfdata string) string {
+
+	line := fmt.Sprintf("SMS %s - %s", CheckStatus[code], message)
+
+	if perfdata != "" {
+		line = fmt.Sprintf("%s | %s", line, perfdata)
+	}
+
+	return line
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a running service is OK, with its response time and uptime as perfdata
+func TestEvaluateCheck01(t *testing.T) {
+	// given
+	service := Service{name: "nginx", action: "check", expect: "started", warnUptime: 10 * time.Minute}
+	result := Result{Records: []Record{{Service: "nginx", State: "started", SubState: "running", PID: 4711, Uptime: 3725, Duration: 0.4123}}}
+
+	// when
+	code, line := evaluateCheck(service, result, nil)
+
+	// then
+	if code != CheckOK {
+		t.Error("Expected ", CheckOK, ", got ", code)
+	}
+
+	if line != "SMS OK - service nginx is started (running, pid 4711, up 1h2m5s) | time=0.412s;;;0 uptime=3725s;600:;;0" {
+		t.Error("Expected OK line, got ", line)
+	}
+}
+
+// a service that started recently warns or is critical
+func TestEvaluateCheck02(t *testing.T) {
+	// given
+	service := Service{name: "nginx", action: "check", expect: "started", warnUptime: 10 * time.Minute, critUptime: time.Minute}
+	uptimes := map[int64]int{30: CheckCritical, 300: CheckWarning, 900: CheckOK}
+
+	for uptime, expected := range uptimes {
+		result := Result{Records: []Record{{Service: "nginx", State: "started", Uptime: uptime}}}
+
+		// when
+		code, line := evaluateCheck(service, result, nil)
+
+		// then
+		if code != expected {
+			t.Error("Expected ", expected, " for uptime ", uptime, ", got ", code, line)
+		}
+	}
+}
+
+// a service in another state than expected is critical, a changing one warns
+func TestEvaluateCheck03(t *testing.T) {
+	// given
+	service := Service{name: "nginx", action: "check", expect: "started"}
+	states := map[string]int{"stopped": CheckCritical, "failed": CheckCritical, "starting": CheckWarning, "unknown": CheckUnknown}
+
+	for state, expected := range states {
+		result := Result{Records: []Record{{Service: "nginx", State: state}}}
+
+		// when
+		code, line := evaluateCheck(service, result, nil)
+
+		// then
+		if code != expected {
+			t.Error("Expected ", expected, " for ", state, ", got ", code)
+		}
+
+		if want := fmt.Sprintf("SMS %s - service nginx is %s, expected started | time=0.000s;;;0 uptime=0s;;;0", CheckStatus[expected], state); line != want {
+			t.Error("Expected ", want, ", got ", line)
+		}
+	}
+}
+
+// a service expected to be stopped is OK when it is stopped, disabled or failed
+func TestEvaluateCheck04(t *testing.T) {
+	// given
+	service := Service{name: "telnet", action: "check", expect: "stopped"}
+	states := map[string]int{"stopped": CheckOK, "disabled": CheckOK, "failed": CheckOK, "started": CheckCritical}
+
+	for state, expected := range states {
+		result := Result{Records: []Record{{Service: "telnet", State: state}}}
+
+		// when
+		code, _ := evaluateCheck(service, result, nil)
+
+		// then
+		if code != expected {
+			t.Error("Expected ", expected, " for ", state, ", got ", code)
+		}
+	}
+}
+
+// a host that cannot be checked is unknown, a service that does not exist is critical
+func TestEvaluateCheck05(t *testing.T) {
+	// given
+	service := Service{name: "nginx", action: "check", expect: "started"}
+	errs := map[error]int{
+		&CommandError{Kind: ErrUnreachable, Detail: "NT_STATUS_HOST_UNREACHABLE"}: CheckUnknown,
+		fmt.Errorf("%w: nginx", ErrServiceNotFound):                               CheckCritical,
+		errors.New("line one\nline two"):                                          CheckUnknown,
+	}
+
+	for err, expected := range errs {
+		// when
+		code, line := evaluateCheck(service, Result{}, err)
+
+		// then
+		if code != expected {
+			t.Error("Expected ", expected, " for ", err, ", got ", code)
+		}
+
+		if want := fmt.Sprintf("SMS %s - %s", CheckStatus[expected], strings.SplitN(err.Error(), "\n", 2)[0]); line != want {
+			t.Error("Expected ", want, ", got ", line)
+		}
+	}
+}
+
+// check uses the handler's status
+func TestCheck01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is running (pid 4711)"}}
+
+	service := Service{host: "myhost", name: "myname", action: "check", expect: "started"}
+
+	// when
+	result, err := runAction(service, &ServiceExecServiceHandler{}, &mock)
+	code, line := evaluateCheck(service, result, err)
+
+	// then
+	if code != CheckOK {
+		t.Error("Expected ", CheckOK, ", got ", code, line)
+	}
+
+	if mock.runs[0] != "sudo service myname status" {
+		t.Error("Expected status, got ", mock.runs[0])
+	}
+}
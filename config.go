@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// name of the config file read from the user's home directory when --config is not given
+const DefaultConfigFile string = ".sms.json"
+
+// time start, stop and the other actions wait for a service when neither the config nor --wait-timeout set it
+const DefaultWaitTimeout time.Duration = 30 * time.Second
+
+// delay between status checks when neither the config nor --poll-interval set it
+const DefaultPollInterval time.Duration = time.Second
+
+// WaitPolicy controls how long and how often sms checks a service's status after changing it
+type WaitPolicy struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	Backoff     float64
+	Jitter      float64
+	StatusDelay time.Duration
+	NoWait      bool
+}
+
+// WaitConfig overrides parts of a WaitPolicy, unset fields keep the value they override
+type WaitConfig struct {
+	WaitTimeout  string   `json:"wait-timeout,omitempty"`
+	PollInterval string   `json:"poll-interval,omitempty"`
+	Backoff      *float64 `json:"backoff,omitempty"`
+	Jitter       *float64 `json:"jitter,omitempty"`
+	StatusDelay  string   `json:"status-delay,omitempty"`
+	NoWait       *bool    `json:"no-wait,omitempty"`
+}
+
+// Config is the content of the config file, wait settings per handler (systemctl, service, sc, samba or a plugin's name) and per service name
+type Config struct {
+	Handlers map[string]WaitConfig `json:"handlers"`
+	Services map[string]WaitConfig `json:"services"`
+}
+
+func loadConfig(file string) (Config, error) {
+
+	var config Config
+
+	data, err := ioutil.ReadFile(file)
+
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("cannot read config %s: %s", file, err.Error())
+	}
+
+	return config, err
+}
+
+// defaultConfig reads the config file from the user's home directory if there is one
+func defaultConfig(home string) Config {
+
+	file := filepath.Join(home, DefaultConfigFile)
+
+	if _, err := os.Stat(file); home == "" || err != nil {
+		return Config{}
+	}
+
+	config, err := loadConfig(file)
+
+	if err != nil {
+		log.Warn("ignoring %s", err.Error())
+	}
+
+	return config
+}
+
+// defaultWaitPolicy is the policy of a handler before the config and the command line are applied
+func defaultWaitPolicy(handler ServiceHandler) WaitPolicy {
+
+	policy := WaitPolicy{Timeout: DefaultWaitTimeout, Interval: DefaultPollInterval, Backoff: 1}
+
+	// sc waits a second before every status check by default, status-delay in the config changes it
+	if _, ok := handler.(*ScExecServiceHandler); ok {
+		policy.StatusDelay = time.Second
+	}
+
+	return policy
+}
+
+// waitPolicy resolves the service's policy, the handler's defaults are overridden by the handler's
+// and then the service's entry of the config and finally by the command line
+func waitPolicy(service Service, handler ServiceHandler) WaitPolicy {
+
+	policy := defaultWaitPolicy(handler)
+
+	policy = policy.apply(service.config.Handlers[handlerName(handler)])
+	policy = policy.apply(service.config.Services[service.name])
+	policy = policy.apply(service.waitOptions)
+
+	return policy
+}
+
+func (p WaitPolicy) apply(c WaitConfig) WaitPolicy {
+
+	p.Timeout = parseWaitDuration("wait-timeout", c.WaitTimeout, p.Timeout)
+	p.Interval = parseWaitDuration("poll-interval", c.PollInterval, p.Interval)
+	p.StatusDelay = parseWaitDuration("status-delay", c.StatusDelay, p.StatusDelay)
+
+	if c.Backoff != nil {
+		p.Backoff = *c.Backoff
+	}
+
+	if c.Jitter != nil {
+		p.Jitter = *c.Jitter
+	}
+
+	if c.NoWait != nil {
+		p.NoWait = *c.NoWait
+	}
+
+	return p
+}
+
+// withDefaults fills in the timeout and interval of a policy that was never resolved
+func (p WaitPolicy) withDefaults() WaitPolicy {
+
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultWaitTimeout
+	}
+
+	if p.Interval <= 0 {
+		p.Interval = DefaultPollInterval
+	}
+
+	return p
+}
+
+func parseWaitDuration(name string, value string, current time.Duration) time.Duration {
+
+	if value == "" {
+		return current
+	}
+
+	d, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Warn("ignoring invalid %s: %s", name, err.Error())
+		return current
+	}
+
+	return d
+}
+
+// handlerName is the name a handler is configured by
+func handlerName(handler ServiceHandler) string {
+
+	switch h := handler.(type) {
+	case *SystemctlServiceHandler:
+		return "systemctl"
+	case *ServiceExecServiceHandler:
+		return "service"
+	case *ScExecServiceHandler:
+		return "sc"
+	case *SambaServiceHandler:
+		return "samba"
+	case *PluginServiceHandler:
+		return h.name
+	}
+
+	return ""
+}
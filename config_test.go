@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the service's config overrides the handler's, the command line overrides both
+func TestWaitPolicy01(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sms.json")
+	os.WriteFile(file, []byte(`{
+		"handlers": {"sc": {"wait-timeout": "60s", "poll-interval": "2s", "status-delay": "500ms"}},
+		"services": {"tomcat": {"wait-timeout": "5m", "backoff": 1.5}}
+	}`), 0644)
+
+	config, err := loadConfig(file)
+
+	jitter := 0.2
+	service := Service{name: "tomcat", config: config, waitOptions: WaitConfig{PollInterval: "3s", Jitter: &jitter}}
+
+	// when
+	policy := waitPolicy(service, &ScExecServiceHandler{})
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	expected := WaitPolicy{Timeout: 5 * time.Minute, Interval: 3 * time.Second, Backoff: 1.5, Jitter: 0.2, StatusDelay: 500 * time.Millisecond}
+
+	if policy != expected {
+		t.Error("Expected ", expected, ", got ", policy)
+	}
+}
+
+// handlers keep their defaults without a config
+func TestWaitPolicy02(t *testing.T) {
+	// given
+	service := Service{name: "myname"}
+
+	// when
+	sc := waitPolicy(service, &ScExecServiceHandler{})
+	systemctl := waitPolicy(service, &SystemctlServiceHandler{})
+
+	// then
+	if sc.StatusDelay != time.Second || sc.Timeout != DefaultWaitTimeout {
+		t.Error("Expected 1s status delay, got ", sc)
+	}
+
+	if systemctl.StatusDelay != 0 || systemctl.Interval != DefaultPollInterval {
+		t.Error("Expected no status delay, got ", systemctl)
+	}
+}
+
+// an invalid config file is reported
+func TestLoadConfig01(t *testing.T) {
+	// given
+	file := filepath.Join(t.TempDir(), "sms.json")
+	os.WriteFile(file, []byte(`{"handlers": [`), 0644)
+
+	// when
+	_, err := loadConfig(file)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+}
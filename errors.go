@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// failures sms tells apart, errors.Is finds them in the errors of the protocol and service handlers
+var (
+	ErrUnreachable      = errors.New("host unreachable")
+	ErrAuthFailed       = errors.New("authentication failed")
+	ErrSudoRejected     = errors.New("sudo rejected the password")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrServiceNotFound  = errors.New("service not found")
+	ErrTimeout          = errors.New("timed out")
+)
+
+// CommandError is a failure recognized in the output or error of a command, it is a Kind for errors.Is
+// and keeps the command's own error for errors.As
+type CommandError struct {
+	Kind   error
+	Detail string
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind.Error(), e.Detail)
+}
+
+func (e *CommandError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// messages of ssh, sudo, systemctl, sc and net rpc by the failure they report, the first match wins
+var failurePatterns = []struct {
+	kind error
+	rp   *regexp.Regexp
+}{
+	{ErrAuthFailed, regexp.MustCompile(`unable to authenticate|NT_STATUS_LOGON_FAILURE|NT_STATUS_WRONG_PASSWORD|FAILED 1326:`)},
+	{ErrSudoRejected, regexp.MustCompile(`(?m)(^|: )Sorry, try again\.|^sudo: (\d+ incorrect password attempts?|a password is required|no tty present.*)`)},
+	{ErrPermissionDenied, regexp.MustCompile(`(?m)^\S+ is not in the sudoers file|^Failed to \w+ .*: (Access denied|Interactive authentication required|Permission denied)|^Access is denied\.|FAILED 5:|NT_STATUS_ACCESS_DENIED|WERR_ACCESS_DENIED`)},
+	{ErrUnreachable, regexp.MustCompile(`(?m)NT_STATUS_(HOST_UNREACHABLE|NETWORK_UNREACHABLE|CONNECTION_REFUSED|IO_TIMEOUT)|^Connection to \S+ failed|FAILED 1722:`)},
+	{ErrServiceNotFound, regexp.MustCompile(`(?m)^Failed to \w+ \S+: Unit \S+ not found|FAILED 1060:|WERR_SERVICE_DOES_NOT_EXIST|WERR_NO_SUCH_SERVICE`)},
+}
+
+// commandError recognizes the failure a command reports in its output or error,
+// anything it does not recognize is returned as it is
+func commandError(err error, output string) error {
+
+	var known *CommandError
+	if errors.As(err, &known) {
+		return err
+	}
+
+	text := output
+	if err != nil {
+		text = fmt.Sprintf("%s\n%s", output, err.Error())
+	}
+
+	for _, failure := range failurePatterns {
+
+		loc := failure.rp.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+
+		// the line that gave the failure away explains it
+		start := strings.LastIndex(text[:loc[0]], "\n") + 1
+		end := len(text)
+		if i := strings.Index(text[loc[1]:], "\n"); i >= 0 {
+			end = loc[1] + i
+		}
+
+		return &CommandError{Kind: failure.kind, Detail: strings.TrimSpace(text[start:end]), Err: err}
+	}
+
+	return err
+}
+
+// connectionError tells a host that cannot be reached from one that refused the credentials
+func connectionError(err error) error {
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return &CommandError{Kind: ErrUnreachable, Detail: err.Error(), Err: err}
+	}
+
+	return commandError(err, "")
+}
+
+// failures by the reason shown in the structured outputs and the code sms exits with
+var failureReasons = []struct {
+	kind   error
+	reason string
+	code   int
+}{
+	{ErrAuthFailed, "auth-failed", ExitAuthFailed},
+	{ErrSudoRejected, "sudo-rejected", ExitAuthFailed},
+	{ErrUnreachable, "unreachable", ExitUnreachable},
+	{ErrPermissionDenied, "permission-denied", ExitPermission},
+	{ErrServiceNotFound, "not-found", ExitNotFound},
+	{ErrTimeout, "timeout", ExitTimeout},
+}
+
+// errorReason names the kind of failure, an error sms does not tell apart is just an error
+func errorReason(err error) string {
+
+	for _, failure := range failureReasons {
+		if errors.Is(err, failure.kind) {
+			return failure.reason
+		}
+	}
+
+	return "error"
+}
+
+// errorExitCode is the code scripts can tell the kind of failure by
+func errorExitCode(err error) int {
+
+	for _, failure := range failureReasons {
+		if errors.Is(err, failure.kind) {
+			return failure.code
+		}
+	}
+
+	return ExitError
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"testing"
+)
+
+// sudo rejecting the password is recognized in the shell's output
+func TestCommandError01(t *testing.T) {
+	// given
+	output := "[sudo] password for myuser: Sorry, try again.\nsudo: 1 incorrect password attempt\n"
+
+	// when
+	err := commandError(nil, output)
+
+	// then
+	if !errors.Is(err, ErrSudoRejected) {
+		t.Fatal("Expected ErrSudoRejected, got ", err)
+	}
+
+	if err.Error() != "sudo rejected the password: [sudo] password for myuser: Sorry, try again." {
+		t.Error("Expected the rejected line, got ", err.Error())
+	}
+}
+
+// sc's error codes are recognized and the exit error is kept
+func TestCommandError02(t *testing.T) {
+	// given
+	exitErr := &exec.ExitError{}
+	outputs := map[string]error{
+		"[SC] OpenService FAILED 5:\r\n\r\nAccess is denied.\r\n":                                            ErrPermissionDenied,
+		"[SC] EnumQueryServicesStatus:OpenService FAILED 1060:\r\n\r\nThe specified service does not exist.": ErrServiceNotFound,
+		"[SC] OpenSCManager FAILED 1722:\r\n\r\nThe RPC server is unavailable.\r\n":                          ErrUnreachable,
+		"Could not connect to server 10.0.0.1\nConnection failed: NT_STATUS_LOGON_FAILURE\n":                 ErrAuthFailed,
+	}
+
+	for output, expected := range outputs {
+		// when
+		err := commandError(exitErr, output)
+
+		// then
+		if !errors.Is(err, expected) {
+			t.Error("Expected ", expected, " for ", output, ", got ", err)
+		}
+
+		var e *exec.ExitError
+		if !errors.As(err, &e) {
+			t.Error("Expected the exit error to be kept, got ", err)
+		}
+	}
+}
+
+// the journal lines of a status are not mistaken for a failure
+func TestCommandError03(t *testing.T) {
+	// given
+	output := `● sudo.service
+   Loaded: loaded
+   Active: active (running)
+Mar 01 10:00:00 myhost sudo[4711]: myuser : 3 incorrect password attempts ; TTY=pts/0
+Mar 01 10:00:01 myhost sshd[4712]: error: Permission denied`
+
+	// when
+	err := commandError(nil, output)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+}
+
+// a host that cannot be reached is told apart from one that refused the login
+func TestConnectionError01(t *testing.T) {
+	// given
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}
+	authErr := errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]")
+
+	// when
+	unreachable := connectionError(dialErr)
+	refused := connectionError(authErr)
+
+	// then
+	if !errors.Is(unreachable, ErrUnreachable) {
+		t.Error("Expected ErrUnreachable, got ", unreachable)
+	}
+
+	if !errors.Is(refused, ErrAuthFailed) {
+		t.Error("Expected ErrAuthFailed, got ", refused)
+	}
+}
+
+// a refused start fails right away instead of waiting for the service
+func TestStartRefused01(t *testing.T) {
+	// given
+	refused := &CommandError{Kind: ErrPermissionDenied, Detail: "Failed to start nginx.service: Access denied"}
+	mock := MockProtocolHandler{
+		results: [20]string{"Failed to start nginx.service: Access denied", "nginx is stopped"},
+		errors:  [20]error{refused},
+	}
+
+	service := Service{host: "myhost", name: "nginx", action: "start"}
+
+	// when
+	_, err := (&ServiceExecServiceHandler{}).Start(service, &mock)
+
+	// then
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Error("Expected ErrPermissionDenied, got ", err)
+	}
+
+	if errorReason(err) != "permission-denied" || errorExitCode(err) != ExitPermission {
+		t.Error("Expected permission-denied and ", ExitPermission, ", got ", errorReason(err), errorExitCode(err))
+	}
+
+	if mock.runs[2] == "sudo service nginx status" {
+		t.Error("Expected a single status check, got ", mock.runs)
+	}
+}
+
+// a service that does not exist is reported as not found whatever made the action fail
+func TestActionFailedError01(t *testing.T) {
+	// given
+	err := error(&ActionFailedError{Service: "nginx", Wanted: ServiceStatusStarted, State: ServiceState{Status: ServiceStatusNotFound},
+		Cause: errors.New("timed out")})
+
+	// then
+	if !errors.Is(err, ErrServiceNotFound) || errorExitCode(err) != ExitNotFound {
+		t.Error("Expected ErrServiceNotFound, got ", err)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// console receives the messages meant for people, they move to stderr when stdout carries a structured output
+var console io.Writer = os.Stdout
+
+// Record is the result of an action on one service, its fields are the stable schema of the structured outputs
+type Record struct {
+	Host         string   `json:"host" yaml:"host"`
+	Service      string   `json:"service" yaml:"service"`
+	Action       string   `json:"action" yaml:"action"`
+	Protocol     string   `json:"protocol" yaml:"protocol"`
+	Handler      string   `json:"handler" yaml:"handler"`
+	State        string   `json:"state" yaml:"state"`
+	SubState     string   `json:"substate" yaml:"substate"`
+	PID          int      `json:"pid" yaml:"pid"`
+	Uptime       int64    `json:"uptime" yaml:"uptime"`
+	StartType    string   `json:"starttype" yaml:"starttype"`
+	Enabled      bool     `json:"enabled" yaml:"enabled"`
+	Description  string   `json:"description" yaml:"description"`
+	DisplayName  string   `json:"displayname" yaml:"displayname"`
+	Binary       string   `json:"binary" yaml:"binary"`
+	Account      string   `json:"account" yaml:"account"`
+	Path         string   `json:"path" yaml:"path"`
+	Dependencies []string `json:"dependencies" yaml:"dependencies"`
+	Dependents   []string `json:"dependents" yaml:"dependents"`
+	Changed      bool     `json:"changed" yaml:"changed"`
+	Started      string   `json:"started" yaml:"started"`
+	Duration     float64  `json:"duration" yaml:"duration"`
+	Error        string   `json:"error" yaml:"error"`
+	Reason       string   `json:"reason" yaml:"reason"`
+}
+
+// columns of the csv output, in the order of the Record's fields
+var recordColumns = []string{"host", "service", "action", "protocol", "handler", "state", "substate", "pid", "uptime",
+	"starttype", "enabled", "description", "displayname", "binary", "account", "path",
+	"dependencies", "dependents", "changed", "started", "duration", "error", "reason"}
+
+// newRecord describes the state of the named service after the service's action
+func newRecord(service Service, name string, handler ServiceHandler, protocol ProtocolHandler, state ServiceState) Record {
+
+	record := Record{
+		Host:        service.host,
+		Service:     name,
+		Action:      service.action,
+		State:       ServiceStatus[state.Status],
+		SubState:    state.SubState,
+		PID:         state.PID,
+		Uptime:      int64(state.Uptime.Seconds()),
+		StartType:   state.StartType,
+		Enabled:     state.IsEnabled(),
+		Description: state.Description,
+	}
+
+	if handler != nil {
+		record.Handler = handlerName(handler)
+	}
+
+	if protocol != nil {
+		record.Protocol = protocolName(protocol)
+	}
+
+	return record
+}
+
+// applyConfig adds the configuration of the config action, a start type the status did not tell is taken from it
+func (r *Record) applyConfig(config ServiceConfig) {
+
+	r.DisplayName = config.DisplayName
+	r.Binary = config.Binary
+	r.Account = config.Account
+	r.Path = config.Path
+
+	if r.StartType == "" {
+		r.StartType = config.StartType
+		r.Enabled = ServiceState{StartType: r.StartType}.IsEnabled()
+	}
+}
+
+// timed sets when the action started and how long it took on every record
+func timed(records []Record, start time.Time) {
+
+	for i := range records {
+		records[i].Started = start.Format(time.RFC3339)
+		records[i].Duration = time.Since(start).Seconds()
+	}
+}
+
+// output of a --format template, it is set by --format rather than --output
+const TemplateOutput string = "template"
+
+// outputs of --output
+var outputs = []string{"text", "table", "json", "yaml", "csv"}
+
+// checkOutput rejects an unknown output and actions without records before connecting
+func checkOutput(service Service) error {
+
+	known := service.output == "" || service.output == TemplateOutput
+	for _, output := range outputs {
+		known = known || service.output == output
+	}
+
+	if !known {
+		return fmt.Errorf("unknown output %s, use %s", service.output, strings.Join(outputs, ", "))
+	}
+
+	if service.output == TemplateOutput {
+		if _, err := parseTemplate(service.format); err != nil {
+			return err
+		}
+	}
+
+	// logs streams the service's own lines, they have no fields to put in records
+	if service.action == "logs" && isStructured(service.output) {
+		return errors.New("logs only prints text, it does not support --output or --format")
+	}
+
+	return nil
+}
+
+// isStructured reports whether the output is meant for programs rather than people
+func isStructured(output string) bool {
+	return output != "" && output != "text"
+}
+
+// writeRecords writes the records as json, yaml, csv or a table
+func writeRecords(w io.Writer, output string, records []Record) error {
+
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err == nil {
+			_, err = fmt.Fprintln(w, string(data))
+		}
+		return err
+
+	case "yaml":
+		data, err := yaml.Marshal(records)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		return err
+
+	case "csv":
+		c := csv.NewWriter(w)
+		c.Write(recordColumns)
+
+		for _, r := range records {
+			c.Write([]string{r.Host, r.Service, r.Action, r.Protocol, r.Handler, r.State, r.SubState,
+				strconv.Itoa(r.PID), strconv.FormatInt(r.Uptime, 10), r.StartType, strconv.FormatBool(r.Enabled),
+				r.Description, r.DisplayName, r.Binary, r.Account, r.Path,
+				strings.Join(r.Dependencies, " "), strings.Join(r.Dependents, " "), strconv.FormatBool(r.Changed), r.Started, strconv.FormatFloat(r.Duration, 'f', 3, 64), r.Error, r.Reason})
+		}
+
+		c.Flush()
+		return c.Error()
+
+	case "table":
+		t := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(t, "HOST\tSERVICE\tSTATE\tPID\tUPTIME\tENABLED\tDESCRIPTION\tERROR")
+
+		for _, r := range records {
+			fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\n", orDash(r.Host), orDash(r.Service), orDash(r.State),
+				orDash(strconv.Itoa(r.PID)), orDash((time.Duration(r.Uptime) * time.Second).String()), r.Enabled,
+				orDash(r.Description), orDash(r.Error))
+		}
+
+		return t.Flush()
+	}
+
+	return fmt.Errorf("unknown output %s, use %s", output, strings.Join(outputs, ", "))
+}
+
+func orDash(value string) string {
+
+	if value == "" || value == "0" || value == "0s" {
+		return "-"
+	}
+
+	return value
+}
+
+// functions of --format templates besides the builtins
+var templateFuncs = template.FuncMap{
+	"duration": formatDuration,
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+	"color":  colorState,
+	"red":    func(s string) string { return colorize("31", s) },
+	"green":  func(s string) string { return colorize("32", s) },
+	"yellow": func(s string) string { return colorize("33", s) },
+	"blue":   func(s string) string { return colorize("34", s) },
+	"bold":   func(s string) string { return colorize("1", s) },
+}
+
+// parseTemplate reads a --format template with the functions sms adds
+func parseTemplate(format string) (*template.Template, error) {
+
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format: %s", err.Error())
+	}
+
+	return tmpl, nil
+}
+
+// writeTemplate executes the template for every record, each on a line of its own
+func writeTemplate(w io.Writer, format string, records []Record) error {
+
+	tmpl, err := parseTemplate(format)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+
+		if err = tmpl.Execute(w, r); err != nil {
+			return fmt.Errorf("invalid --format: %s", err.Error())
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// formatDuration prints seconds, like the uptime and duration of a record, as a duration rounded to the second
+func formatDuration(seconds interface{}) string {
+
+	var d time.Duration
+
+	switch s := seconds.(type) {
+	case int64:
+		d = time.Duration(s) * time.Second
+	case int:
+		d = time.Duration(s) * time.Second
+	case float64:
+		d = time.Duration(s * float64(time.Second))
+	case time.Duration:
+		d = s
+	}
+
+	return d.Round(time.Second).String()
+}
+
+// colorState colors a state the way people read it, started is green, stopped and failed are red and the rest is yellow
+func colorState(state string) string {
+
+	switch state {
+	case ServiceStatus[ServiceStatusStarted]:
+		return colorize("32", state)
+	case ServiceStatus[ServiceStatusStopped], ServiceStatus[ServiceStatusFailed], ServiceStatus[ServiceStatusNotFound]:
+		return colorize("31", state)
+	}
+
+	return colorize("33", state)
+}
+
+// colorize wraps s in an ANSI color unless NO_COLOR is set
+func colorize(code string, s string) string {
+
+	if _, off := os.LookupEnv("NO_COLOR"); off {
+		return s
+	}
+
+	return fmt.Sprintf("\x1b[%sm%s\x1b[0m", code, s)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// the status of a service becomes a record with the handler and protocol
+func TestRecords01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is running (pid 4711)"}}
+
+	service := Service{host: "myhost", name: "myname", action: "status", output: "json"}
+
+	// when
+	result, err := runAction(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(result.Records) != 1 {
+		t.Fatal("Expected 1 record, got ", result.Records)
+	}
+
+	record := result.Records[0]
+
+	if record.Host != "myhost" || record.Service != "myname" || record.Action != "status" || record.Handler != "service" || record.State != "started" || record.PID != 4711 {
+		t.Error("Expected status of myname started, got ", record)
+	}
+}
+
+// records are written as json with the stable field names
+func TestWriteRecords01(t *testing.T) {
+	// given
+	var out bytes.Buffer
+	records := []Record{{Host: "myhost", Service: "myname", Action: "start", State: "started", Changed: true}}
+
+	// when
+	err := writeRecords(&out, "json", records)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	var decoded []map[string]interface{}
+	json.Unmarshal(out.Bytes(), &decoded)
+
+	if len(decoded) != 1 || decoded[0]["service"] != "myname" || decoded[0]["state"] != "started" || decoded[0]["changed"] != true {
+		t.Error("Expected myname started and changed, got ", out.String())
+	}
+
+	if _, found := decoded[0]["error"]; !found {
+		t.Error("Expected an error field, got ", out.String())
+	}
+}
+
+// records are written as csv and yaml
+func TestWriteRecords02(t *testing.T) {
+	// given
+	records := []Record{{Host: "myhost", Service: "myname", Action: "status", State: "stopped", Error: "a, b", Reason: "error"}}
+
+	// when
+	var csvOut, yamlOut bytes.Buffer
+	csvErr := writeRecords(&csvOut, "csv", records)
+	yamlErr := writeRecords(&yamlOut, "yaml", records)
+
+	// then
+	if csvErr != nil || yamlErr != nil {
+		t.Error("Expected NO Errors, got ", csvErr, yamlErr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+
+	if len(lines) != 2 || lines[0] != strings.Join(recordColumns, ",") || !strings.HasSuffix(lines[1], `,"a, b",error`) {
+		t.Error("Expected header and quoted error, got ", csvOut.String())
+	}
+
+	if !strings.Contains(yamlOut.String(), "- host: myhost\n") || !strings.Contains(yamlOut.String(), "state: stopped\n") {
+		t.Error("Expected yaml list, got ", yamlOut.String())
+	}
+}
+
+// an unknown output is reported
+func TestWriteRecords03(t *testing.T) {
+	// when
+	err := writeRecords(&bytes.Buffer{}, "xml", nil)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+}
+
+// a template is printed for every record
+func TestWriteTemplate01(t *testing.T) {
+	// given
+	t.Setenv("NO_COLOR", "1")
+
+	var out bytes.Buffer
+	records := []Record{
+		{Host: "myhost", Service: "nginx", State: "started", PID: 4711, Uptime: 3725},
+		{Host: "myhost", Service: "cron", State: "stopped"},
+	}
+
+	// when
+	err := writeTemplate(&out, "{{.Host}} {{.Service}} {{color .State}} {{.PID}} {{duration .Uptime}}", records)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if out.String() != "myhost nginx started 4711 1h2m5s\nmyhost cron stopped 0 0s\n" {
+		t.Error("Expected a line per record, got ", out.String())
+	}
+}
+
+// states are colored unless NO_COLOR is set
+func TestWriteTemplate02(t *testing.T) {
+	// given
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		t.Skip("NO_COLOR is set")
+	}
+
+	var out bytes.Buffer
+	records := []Record{{Service: "nginx", State: "failed"}}
+
+	// when
+	err := writeTemplate(&out, "{{bold .Service}} {{color .State}}", records)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if out.String() != "\x1b[1mnginx\x1b[0m \x1b[31mfailed\x1b[0m\n" {
+		t.Errorf("Expected bold name and red state, got %q", out.String())
+	}
+}
+
+// a template that does not parse is reported
+func TestWriteTemplate03(t *testing.T) {
+	// given
+	var out bytes.Buffer
+
+	// when
+	err := writeTemplate(&out, "{{.Service", []Record{{Service: "nginx"}})
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "invalid --format") {
+		t.Error("Expected invalid --format, got ", err)
+	}
+}
+
+// the configuration of the config action is part of the record
+func TestRecords02(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`[SC] QueryServiceConfig SUCCESS
+
+SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        START_TYPE         : 2   AUTO_START
+        ERROR_CONTROL      : 1   NORMAL
+        BINARY_PATH_NAME   : C:\myname\myname.exe
+        DISPLAY_NAME       : My Name
+        SERVICE_START_NAME : LocalSystem`,
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 4  RUNNING`,
+	}}
+
+	service := Service{host: "myhost", name: "myname", action: "config", output: "json"}
+
+	// when
+	result, err := runAction(service, &ScExecServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(result.Records) != 1 {
+		t.Fatal("Expected 1 record, got ", result.Records)
+	}
+
+	record := result.Records[0]
+
+	if record.Binary != `C:\myname\myname.exe` || record.Account != "LocalSystem" || record.DisplayName != "My Name" || record.StartType != "auto" || !record.Enabled {
+		t.Error("Expected the configuration, got ", record)
+	}
+
+	if record.State != "started" {
+		t.Error("Expected started, got ", record.State)
+	}
+}
+
+// the dependencies of a service become a record of their own
+func TestRecords03(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{`myname.service
+  network-online.target
+  postgresql.service`, `myname.service
+  myapp.service`}}
+
+	service := Service{host: "myhost", name: "myname", action: "deps", output: "json"}
+
+	// when
+	result, err := runAction(service, &SystemctlServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(result.Records) != 1 {
+		t.Fatal("Expected 1 record, got ", result.Records)
+	}
+
+	record := result.Records[0]
+
+	if record.Service != "myname" || record.Action != "deps" || len(record.Dependencies) != 1 || record.Dependencies[0] != "postgresql" ||
+		len(record.Dependents) != 1 || record.Dependents[0] != "myapp" {
+		t.Error("Expected the dependencies of myname, got ", record)
+	}
+}
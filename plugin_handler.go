@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// prefix of the executables on the PATH that are used as external service handlers
+const PluginPrefix string = "sms-handler-"
+
+// version of the JSON stdio protocol spoken with the external service handlers
+const PluginProtocolVersion int = 1
+
+// time a plugin gets to answer issupported, which every invocation of sms asks every plugin
+const PluginSupportTimeout time.Duration = 5 * time.Second
+
+// time a plugin gets to answer any other call, on top of the time the service's actions may wait
+const PluginCallTimeout time.Duration = time.Minute
+
+// time a plugin gets to exit after its result before it is killed
+const PluginExitTimeout time.Duration = time.Second
+
+// PluginServiceHandler delegates to an external executable (sms-handler-<name>).
+//
+// For every call the executable is started and sent a single "call" message on stdin.
+// The plugin answers with newline delimited JSON messages on stdout, either "run"
+// messages asking sms to execute a command through the current ProtocolHandler
+// (answered with an "output" message) or a final "result" message.
+type PluginServiceHandler struct {
+	name    string
+	path    string
+	service Service
+	timeout time.Duration
+}
+
+type pluginService struct {
+	User   string `json:"user"`
+	Host   string `json:"host"`
+	Port   string `json:"port"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Now    bool   `json:"now,omitempty"`
+	Since  int64  `json:"since,omitempty"`
+	Lines  int    `json:"lines,omitempty"`
+	PID    int    `json:"pid,omitempty"`
+
+	UnitFile    string `json:"unitfile,omitempty"`
+	InitScript  string `json:"initscript,omitempty"`
+	BinPath     string `json:"binpath,omitempty"`
+	DisplayName string `json:"displayname,omitempty"`
+	StartType   string `json:"starttype,omitempty"`
+}
+
+// pluginEntry is a service found by a plugin's search
+type pluginEntry struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayname,omitempty"`
+	Status      string `json:"status,omitempty"`
+	StartType   string `json:"starttype,omitempty"`
+}
+
+type pluginMessage struct {
+	Version    int            `json:"version"`
+	Type       string         `json:"type"`
+	Method     string         `json:"method,omitempty"`
+	Service    *pluginService `json:"service,omitempty"`
+	Cmd        string         `json:"cmd,omitempty"`
+	Sudo       bool           `json:"sudo,omitempty"`
+	Output     string         `json:"output,omitempty"`
+	Supported  bool           `json:"supported,omitempty"`
+	Status     string         `json:"status,omitempty"`
+	SubState   string         `json:"substate,omitempty"`
+	PID        int            `json:"pid,omitempty"`
+	Uptime     int64          `json:"uptime,omitempty"`
+	StartType  string         `json:"starttype,omitempty"`
+	Desc       string         `json:"description,omitempty"`
+	Services   []pluginEntry  `json:"services,omitempty"`
+	Deps       []string       `json:"dependencies,omitempty"`
+	Dependents []string       `json:"dependents,omitempty"`
+	Binary     string         `json:"binary,omitempty"`
+	Account    string         `json:"account,omitempty"`
+	Path       string         `json:"path,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (r *PluginServiceHandler) Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+	log.Info("search for %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "search")
+
+	return Search(service, pluginEntries(result), err)
+}
+
+func (r *PluginServiceHandler) List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+
+	result, err := r.call(service, protocol, "list")
+
+	return pluginEntries(result), err
+}
+
+func (r *PluginServiceHandler) Start(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("starting %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "start")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Status(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("determining service %s status using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "status")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+	return statusEach(r, service, names, protocol)
+}
+
+func (r *PluginServiceHandler) Stop(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("stopping %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "stop")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Restart(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("restarting %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "restart")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Reload(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("reloading %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "reload")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Pause(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("pausing %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "pause")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Continue(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("continuing %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "continue")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Logs(service Service, protocol ProtocolHandler, out io.Writer) error {
+
+	if service.follow {
+		return notSupported("logs --follow", r)
+	}
+
+	result, err := r.call(service, protocol, "logs")
+
+	if err == nil {
+		fmt.Fprint(out, result.Output)
+	}
+
+	return err
+}
+
+func (r *PluginServiceHandler) Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error) {
+
+	result, err := r.call(service, protocol, "deps")
+
+	return ServiceDependencies{Dependencies: result.Deps, Dependents: result.Dependents}, err
+}
+
+func (r *PluginServiceHandler) Config(service Service, protocol ProtocolHandler) (ServiceConfig, error) {
+
+	result, err := r.call(service, protocol, "config")
+
+	config := ServiceConfig{
+		Binary:      result.Binary,
+		Account:     result.Account,
+		StartType:   result.StartType,
+		Path:        result.Path,
+		DisplayName: result.Desc,
+	}
+
+	return config, err
+}
+
+func (r *PluginServiceHandler) Install(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("installing %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "install")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("uninstalling %s service using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "uninstall")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Enable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("enabling %s service at boot using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "enable")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) Disable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("disabling %s service at boot using plugin %s", service.name, r.name)
+
+	result, err := r.call(service, protocol, "disable")
+
+	return pluginState(result), err
+}
+
+func (r *PluginServiceHandler) StartType(service Service, protocol ProtocolHandler) (string, error) {
+
+	result, err := r.call(service, protocol, "status")
+
+	return result.StartType, err
+}
+
+func (r *PluginServiceHandler) IsSupported(protocol ProtocolHandler) bool {
+
+	result, err := r.call(r.service, protocol, "issupported")
+
+	if err != nil {
+		log.Debug("plugin %s failed: %s", r.name, err.Error())
+	}
+
+	return err == nil && result.Supported
+}
+
+func (r *PluginServiceHandler) Kill(service Service, protocol ProtocolHandler, pid int) error {
+	log.Info("killing %s service using plugin %s", service.name, r.name)
+
+	service.pid = pid
+	_, err := r.call(service, protocol, "kill")
+
+	return err
+}
+
+func (r *PluginServiceHandler) call(service Service, protocol ProtocolHandler, method string) (pluginMessage, error) {
+
+	timeout := r.callTimeout(service, method)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, r.path)
+	cmd.Stderr = os.Stderr
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return pluginMessage{}, err
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return pluginMessage{}, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return pluginMessage{}, err
+	}
+
+	// the children of a killed plugin may keep its stdout open, stop reading it as well
+	go func() {
+		<-ctx.Done()
+		out.Close()
+	}()
+
+	result, err := pluginCall(in, out, service, protocol, method)
+	in.Close()
+
+	answered := err == nil
+
+	if answered {
+		timer := time.AfterFunc(PluginExitTimeout, cancel)
+		defer timer.Stop()
+	}
+
+	waitErr := cmd.Wait()
+
+	switch {
+	case !answered && ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("plugin %s %w after %s", r.name, ErrTimeout, timeout)
+	case answered && ctx.Err() != nil:
+		log.Debug("killed plugin %s, it did not exit after its result", r.name)
+	case err == nil && waitErr != nil:
+		err = fmt.Errorf("plugin %s exited with %s", r.name, waitErr.Error())
+	}
+
+	return result, err
+}
+
+// callTimeout is the time a plugin gets for method, an action may first wait for the service
+func (r *PluginServiceHandler) callTimeout(service Service, method string) time.Duration {
+
+	if r.timeout > 0 {
+		return r.timeout
+	}
+
+	if method == "issupported" {
+		return PluginSupportTimeout
+	}
+
+	wait := service.wait.withDefaults()
+
+	return wait.Timeout + service.killAfter + PluginCallTimeout
+}
+
+// pluginCall sends the call message for method and serves the plugin's run requests until it replies with a result
+func pluginCall(in io.Writer, out io.Reader, service Service, protocol ProtocolHandler, method string) (pluginMessage, error) {
+
+	encoder := json.NewEncoder(in)
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	err := encoder.Encode(pluginMessage{
+		Version: PluginProtocolVersion,
+		Type:    "call",
+		Method:  method,
+		Service: &pluginService{
+			User:   service.user,
+			Host:   service.host,
+			Port:   service.port,
+			Name:   service.name,
+			Action: service.action,
+			Now:    service.now,
+			Since:  int64(service.since.Seconds()),
+			Lines:  service.lines,
+			PID:    service.pid,
+
+			UnitFile:    service.definition.UnitFile,
+			InitScript:  service.definition.InitScript,
+			BinPath:     service.definition.BinPath,
+			DisplayName: service.definition.DisplayName,
+			StartType:   service.definition.StartType,
+		},
+	})
+
+	for err == nil && scanner.Scan() {
+
+		var msg pluginMessage
+
+		if err = json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			break
+		}
+
+		if msg.Version != PluginProtocolVersion {
+			return msg, fmt.Errorf("unsupported plugin protocol version %d", msg.Version)
+		}
+
+		switch msg.Type {
+		case "run":
+			reply := pluginMessage{Version: PluginProtocolVersion, Type: "output"}
+
+			// the protocols cannot run an empty command, the local one does not even split it
+			if strings.TrimSpace(msg.Cmd) == "" {
+				reply.Error = "run needs a cmd"
+				err = encoder.Encode(reply)
+				break
+			}
+
+			cmd := msg.Cmd
+			if msg.Sudo {
+				cmd = addSudo(cmd, service)
+			}
+
+			stdout, runErr := protocol.Run(service, cmd)
+			reply.Output = stdout
+			if runErr != nil {
+				reply.Error = runErr.Error()
+			}
+
+			err = encoder.Encode(reply)
+
+		case "result":
+			if msg.Error != "" {
+				return msg, errors.New(msg.Error)
+			}
+			return msg, nil
+
+		default:
+			return msg, fmt.Errorf("unexpected plugin message type '%s'", msg.Type)
+		}
+	}
+
+	if err == nil {
+		err = scanner.Err()
+	}
+
+	if err == nil {
+		err = errors.New("plugin closed the connection without a result")
+	}
+
+	return pluginMessage{}, err
+}
+
+func pluginEntries(result pluginMessage) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+
+	for _, e := range result.Services {
+		state := ServiceState{Status: statusByName(e.Status), StartType: e.StartType}
+		entries = append(entries, ServiceEntry{Name: e.Name, DisplayName: e.DisplayName, State: state})
+	}
+
+	return entries
+}
+
+func pluginState(result pluginMessage) ServiceState {
+
+	state := ServiceState{
+		Status:      ServiceStatusUnknown,
+		SubState:    result.SubState,
+		PID:         result.PID,
+		Uptime:      time.Duration(result.Uptime) * time.Second,
+		StartType:   result.StartType,
+		Description: result.Desc,
+		Output:      result.Output,
+	}
+
+	state.Status = statusByName(result.Status)
+
+	return state
+}
+
+// discoverPlugins finds the sms-handler-<name> executables on the PATH
+func discoverPlugins(service Service) []ServiceHandler {
+
+	handlers := []ServiceHandler{}
+	found := map[string]bool{}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+
+		matches, _ := filepath.Glob(filepath.Join(dir, PluginPrefix+"*"))
+		sort.Strings(matches)
+
+		for _, match := range matches {
+
+			name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), PluginPrefix), filepath.Ext(match))
+
+			if found[name] || !isExecutable(match) {
+				continue
+			}
+
+			log.Debug("found handler plugin %s at %s", name, match)
+			found[name] = true
+			handlers = append(handlers, ServiceHandler(&PluginServiceHandler{name: name, path: match, service: service}))
+		}
+	}
+
+	return handlers
+}
+
+func isExecutable(file string) bool {
+
+	info, err := os.Stat(file)
+
+	return err == nil && !info.IsDir() && (info.Mode()&0111 != 0 || strings.HasSuffix(strings.ToLower(file), ".exe"))
+}
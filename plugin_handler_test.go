@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakePlugin plays the plugin side of the protocol, sending the given replies in order
+func fakePlugin(t *testing.T, in io.Reader, out io.WriteCloser, replies []pluginMessage) []pluginMessage {
+
+	received := []pluginMessage{}
+	scanner := bufio.NewScanner(in)
+	encoder := json.NewEncoder(out)
+
+	for _, reply := range replies {
+
+		if !scanner.Scan() {
+			t.Error("Expected message from sms, got none")
+			break
+		}
+
+		var msg pluginMessage
+		json.Unmarshal(scanner.Bytes(), &msg)
+		received = append(received, msg)
+
+		encoder.Encode(reply)
+	}
+
+	out.Close()
+
+	return received
+}
+
+// plugin runs a command through the protocol and returns status
+func TestPluginCall01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is up"}}
+
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		sudo:   "mysudo",
+		action: "status"}
+
+	smsIn, pluginOut := io.Pipe()
+	pluginIn, smsOut := io.Pipe()
+
+	done := make(chan []pluginMessage)
+	go func() {
+		done <- fakePlugin(t, pluginIn, pluginOut, []pluginMessage{
+			{Version: 1, Type: "run", Cmd: "mysvc myname status", Sudo: true},
+			{Version: 1, Type: "result", Status: "started", PID: 7112, Uptime: 60},
+		})
+	}()
+
+	// when
+	result, err := pluginCall(smsOut, smsIn, service, &mock, "status")
+	received := <-done
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if pluginState(result).Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result.Status)
+	}
+
+	if pluginState(result).PID != 7112 || pluginState(result).Uptime != time.Minute {
+		t.Error("Expected pid 7112 up 1m, got ", pluginState(result))
+	}
+
+	if received[0].Type != "call" || received[0].Method != "status" || received[0].Service.Name != "myname" {
+		t.Error("Expected status call, got ", received[0])
+	}
+
+	if received[1].Type != "output" || received[1].Output != "myname is up" {
+		t.Error("Expected command output, got ", received[1])
+	}
+
+	if mock.runs[0] != "echo 'mysudo' | sudo -S mysvc myname status" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// plugin speaks a different protocol version
+func TestPluginCall02(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	smsIn, pluginOut := io.Pipe()
+	pluginIn, smsOut := io.Pipe()
+
+	go fakePlugin(t, pluginIn, pluginOut, []pluginMessage{
+		{Version: 99, Type: "result", Status: "started"},
+	})
+
+	// when
+	_, err := pluginCall(smsOut, smsIn, Service{name: "myname"}, &mock, "status")
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+
+	if mock.run != 0 {
+		t.Error("Expected runs of 0, got ", mock.run)
+	}
+}
+
+// plugin reports an error
+func TestPluginCall03(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	smsIn, pluginOut := io.Pipe()
+	pluginIn, smsOut := io.Pipe()
+
+	go fakePlugin(t, pluginIn, pluginOut, []pluginMessage{
+		{Version: 1, Type: "result", Error: "no such service"},
+	})
+
+	// when
+	_, err := pluginCall(smsOut, smsIn, Service{name: "myname"}, &mock, "start")
+
+	// then
+	if err == nil || err.Error() != "no such service" {
+		t.Error("Expected 'no such service' error, got ", err)
+	}
+}
+
+// plugin asks to run an empty command
+func TestPluginCall04(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	smsIn, pluginOut := io.Pipe()
+	pluginIn, smsOut := io.Pipe()
+
+	done := make(chan []pluginMessage)
+	go func() {
+		done <- fakePlugin(t, pluginIn, pluginOut, []pluginMessage{
+			{Version: 1, Type: "run", Cmd: " ", Sudo: true},
+			{Version: 1, Type: "result", Status: "stopped"},
+		})
+	}()
+
+	// when
+	_, err := pluginCall(smsOut, smsIn, Service{name: "myname"}, &mock, "status")
+	received := <-done
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if received[1].Type != "output" || received[1].Error != "run needs a cmd" {
+		t.Error("Expected an output with an error, got ", received[1])
+	}
+
+	if mock.run != 0 {
+		t.Error("Expected runs of 0, got ", mock.run)
+	}
+}
+
+// plugins are discovered on the PATH
+func TestDiscoverPlugins01(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "sms-handler-tomcat"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(dir, "sms-handler-notexec"), []byte(""), 0644)
+	os.WriteFile(filepath.Join(dir, "other-tool"), []byte("#!/bin/sh\n"), 0755)
+
+	t.Setenv("PATH", dir)
+
+	// when
+	handlers := discoverPlugins(Service{name: "myname"})
+
+	// then
+	if len(handlers) != 1 {
+		t.Fatal("Expected 1 plugin, got ", len(handlers))
+	}
+
+	plugin := handlers[0].(*PluginServiceHandler)
+
+	if plugin.name != "tomcat" {
+		t.Error("Expected tomcat, got ", plugin.name)
+	}
+
+	if plugin.service.name != "myname" {
+		t.Error("Expected myname, got ", plugin.service.name)
+	}
+}
+
+// a plugin that does not answer is killed after its timeout
+func TestPluginTimeout01(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "sms-handler-hangs")
+	os.WriteFile(path, []byte("#!/bin/sh\nread line\nexec sleep 30\n"), 0755)
+
+	plugin := PluginServiceHandler{name: "hangs", path: path, timeout: 200 * time.Millisecond}
+
+	// when
+	start := time.Now()
+	_, err := plugin.call(Service{name: "myname"}, &MockProtocolHandler{}, "status")
+
+	// then
+	if !errors.Is(err, ErrTimeout) {
+		t.Error("Expected ErrTimeout, got ", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected the plugin to be killed, took ", time.Since(start))
+	}
+}
+
+// a plugin that does not exit after its result is killed, the result counts
+func TestPluginTimeout02(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "sms-handler-lingers")
+	os.WriteFile(path, []byte("#!/bin/sh\nread line\necho '{\"version\":1,\"type\":\"result\",\"status\":\"started\"}'\nexec sleep 30\n"), 0755)
+
+	plugin := PluginServiceHandler{name: "lingers", path: path}
+
+	// when
+	start := time.Now()
+	state, err := plugin.Status(Service{name: "myname"}, &MockProtocolHandler{})
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected started, got ", state)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected the plugin to be killed, took ", time.Since(start))
+	}
+}
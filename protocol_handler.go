@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 "runtime"
@@ -18,9 +22,36 @@ type ProtocolHandler interface {
 	IsPasswordNeeded(service Service) bool
 	OpenConnection(service Service) error
 	Run(service Service, cmd string) (string, error)
+	Stream(service Service, cmd string, out io.Writer) error
+	Upload(service Service, path string, content []byte) error
 	CloseConnection(service Service)
 }
 
+// ExitCodeProtocolHandler is implemented by protocols that can report the exit code of a command,
+// the code is NoExitCode when it could not be determined
+type ExitCodeProtocolHandler interface {
+	RunExitCode(service Service, cmd string) (string, int, error)
+}
+
+// exit code of a command whose exit code is not known
+const NoExitCode int = -1
+
+// printed after a command run over SSH, followed by its exit code
+const exitCodeMarker string = "__sms_exit_code="
+
+// protocolName is the name of a protocol in the results
+func protocolName(protocol ProtocolHandler) string {
+
+	switch protocol.(type) {
+	case *SSHProtocolHandler:
+		return "ssh"
+	case *WindowsProtocolHandler:
+		return "local"
+	}
+
+	return ""
+}
+
 type SSHProtocolHandler struct {
 	client *ssh.Client
 }
@@ -57,6 +88,10 @@ func (r *SSHProtocolHandler) OpenConnection(service Service) error {
 		r.client = conn
 	}
 
+	if error != nil {
+		error = connectionError(error)
+	}
+
 	return error
 }
 
@@ -99,7 +134,7 @@ func (r *SSHProtocolHandler) Run(service Service, cmd string) (string, error) {
 	bytes, err := r.ReadBuffer(&stdout)
 	//response.WriteString(string(bytes))
 
-	fmt.Fprintln(in, cmd)
+	fmt.Fprintln(in, withPosixLocale(cmd))
 	bytes, err = r.ReadBuffer(&stdout)
 	response.WriteString(string(bytes))
 
@@ -113,7 +148,81 @@ func (r *SSHProtocolHandler) Run(service Service, cmd string) (string, error) {
 		log.Debug("received error %s", err.Error())
 	}
 
-	return response.String(), err
+	// the shell does not fail with its commands, their output tells what went wrong
+	return response.String(), commandError(err, response.String())
+}
+
+// RunExitCode runs cmd in the shell like Run, echoing its exit code after the output
+func (r *SSHProtocolHandler) RunExitCode(service Service, cmd string) (string, int, error) {
+
+	stdout, err := r.Run(service, fmt.Sprintf("%s; echo %s$?", cmd, exitCodeMarker))
+
+	return splitExitCode(stdout, err)
+}
+
+// splitExitCode removes the exit code marker from stdout and returns the code it carries
+func splitExitCode(stdout string, err error) (string, int, error) {
+
+	rp := regexp.MustCompile(`(?m)^` + exitCodeMarker + `(\d+)\s*$`)
+
+	m := rp.FindStringSubmatchIndex(stdout)
+	if m == nil {
+		return stdout, NoExitCode, err
+	}
+
+	code, _ := strconv.Atoi(stdout[m[2]:m[3]])
+
+	return stdout[:m[0]] + stdout[m[1]:], code, err
+}
+
+// Stream runs cmd without a terminal, copying its output to out until the command exits
+func (r *SSHProtocolHandler) Stream(service Service, cmd string, out io.Writer) error {
+
+	cmdString := cmd
+	if service.sudo != "" {
+		cmdString = strings.Replace(cmd, service.sudo, "******", -1)
+	}
+
+	log.Debug("streaming cmd: %s", cmdString)
+
+	session, err := r.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = out
+	session.Stderr = out
+
+	return session.Run(withPosixLocale(cmd))
+}
+
+// Upload copies content to path on the remote host over a new session of the SSH connection
+func (r *SSHProtocolHandler) Upload(service Service, path string, content []byte) error {
+
+	log.Debug("uploading %d bytes to %s", len(content), path)
+
+	session, err := r.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+
+	session.Stdin = bytes.NewReader(content)
+	session.Stderr = &stderr
+
+	if err = session.Run(fmt.Sprintf("cat > '%s'", path)); err != nil {
+		return fmt.Errorf("upload to %s failed: %s %s", path, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// withPosixLocale sets LC_ALL=C for the remote shell and the commands it starts (sudo keeps LC_ALL) so they print untranslated output
+func withPosixLocale(cmd string) string {
+	return "export LC_ALL=C; " + cmd
 }
 
 func (r *SSHProtocolHandler) ReadBuffer(stdout *bytes.Buffer) ([]byte, error) {
@@ -137,7 +246,7 @@ func (r *SSHProtocolHandler) ReadBuffer(stdout *bytes.Buffer) ([]byte, error) {
 		count += 1
 
 		if count > 10 {
-			return nil, errors.New("ReadBuffer timeout")
+			return nil, fmt.Errorf("ReadBuffer %w", ErrTimeout)
 		}
 	}
 }
@@ -168,17 +277,110 @@ func (r *WindowsProtocolHandler) Run(service Service, cmd string) (string, error
 
 	log.Debug("sending cmd: ", cmd)
 
-	parts := strings.Fields(cmd)
+	parts := splitCommand(cmd)
 	head := parts[0]
 	parts = parts[1:len(parts)]
 
-	s, err := exec.Command(head, parts...).CombinedOutput()
+	command := exec.Command(head, parts...)
+	command.Env = localeEnv()
+
+	s, err := command.CombinedOutput()
 
 	log.Debug("got response ", string(s))
 	log.Debug("got error ", err)
 
+	if err != nil {
+		err = commandError(err, string(s))
+	}
+
 	return string(s), err
 }
 
+// RunExitCode runs cmd like Run, a command that exits with a non-zero code is not an error
+func (r *WindowsProtocolHandler) RunExitCode(service Service, cmd string) (string, int, error) {
+
+	stdout, err := r.Run(service, cmd)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+
+		// a failure sms recognizes is still an error
+		var known *CommandError
+		if errors.As(err, &known) {
+			return stdout, exitErr.ExitCode(), err
+		}
+
+		return stdout, exitErr.ExitCode(), nil
+	}
+
+	if err != nil {
+		return stdout, NoExitCode, err
+	}
+
+	return stdout, 0, nil
+}
+
+func (r *WindowsProtocolHandler) Stream(service Service, cmd string, out io.Writer) error {
+
+	log.Debug("streaming cmd: ", cmd)
+
+	parts := splitCommand(cmd)
+
+	command := exec.Command(parts[0], parts[1:]...)
+	command.Env = localeEnv()
+	command.Stdout = out
+	command.Stderr = out
+
+	return command.Run()
+}
+
+// Upload writes content to path, the commands of this protocol run on the local machine
+func (r *WindowsProtocolHandler) Upload(service Service, path string, content []byte) error {
+	return ioutil.WriteFile(path, content, 0644)
+}
+
 func (r *WindowsProtocolHandler) CloseConnection(service Service) {
 }
+
+// localeEnv forces the C locale on the commands run on a POSIX machine, windows commands keep the environment
+func localeEnv() []string {
+
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	return append(os.Environ(), "LC_ALL=C")
+}
+
+// splitCommand splits cmd on whitespace, keeping double quoted arguments such as binPath= "C:\Program Files\app.exe" together
+func splitCommand(cmd string) []string {
+
+	parts := []string{}
+	var part bytes.Buffer
+	quoted := false
+	inPart := false
+
+	for _, c := range cmd {
+
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inPart = true
+		case (c == ' ' || c == '\t' || c == '\n') && !quoted:
+			if inPart {
+				parts = append(parts, part.String())
+				part.Reset()
+				inPart = false
+			}
+		default:
+			part.WriteRune(c)
+			inPart = true
+		}
+	}
+
+	if inPart {
+		parts = append(parts, part.String())
+	}
+
+	return parts
+}
@@ -1,3 +1,72 @@
 package main
 
-import ()
+import (
+	"runtime"
+	"testing"
+)
+
+// test splitting a command keeps quoted arguments together
+func TestSplitCommand01(t *testing.T) {
+	// given
+	cmd := `sc \\myhost create myname binPath= "C:\Program Files\myname\myname.exe" DisplayName= "My Name"`
+
+	// when
+	parts := splitCommand(cmd)
+
+	// then
+	if len(parts) != 8 {
+		t.Fatal("Expected 8 parts, got ", parts)
+	}
+
+	if parts[5] != `C:\Program Files\myname\myname.exe` {
+		t.Error("Expected binary path, got ", parts[5])
+	}
+
+	if parts[7] != "My Name" {
+		t.Error("Expected My Name, got ", parts[7])
+	}
+}
+
+// test the exit code marker is removed from the output
+func TestSplitExitCode01(t *testing.T) {
+	// given
+	stdout := "myname is stopped\r\n" + exitCodeMarker + "3\r\n"
+
+	// when
+	out, code, err := splitExitCode(stdout, nil)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if code != 3 {
+		t.Error("Expected 3, got ", code)
+	}
+
+	if out != "myname is stopped\r\n" {
+		t.Errorf("Expected output without marker, got %q", out)
+	}
+}
+
+// test output without the marker has no exit code
+func TestSplitExitCode02(t *testing.T) {
+	// when
+	out, code, _ := splitExitCode("myname is running", nil)
+
+	// then
+	if code != NoExitCode || out != "myname is running" {
+		t.Error("Expected no exit code, got ", code, out)
+	}
+}
+
+// test local commands on linux run in the C locale
+func TestLocaleEnv01(t *testing.T) {
+	// when
+	env := localeEnv()
+
+	// then
+	if runtime.GOOS != "windows" && (len(env) == 0 || env[len(env)-1] != "LC_ALL=C") {
+		t.Error("Expected LC_ALL=C, got ", env)
+	}
+}
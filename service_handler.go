@@ -1,66 +1,279 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// number of status checks after killing a service before giving up
+const KillStatusChecks int = 10
+
+// number of log lines the logs action shows when --lines is not given
+const DefaultLogLines int = 50
+
+// number of log lines attached to a failed action when --lines is not given
+const DiagnosticLogLines int = 20
+
+// longest delay between two status checks when backing off
+const MaxPollInterval time.Duration = 30 * time.Second
+
+// StatusPoll controls how often and for how long pollStatus checks the status of a service
+type StatusPoll struct {
+	Attempts int           // maximum number of rechecks, used when no Timeout is set
+	Timeout  time.Duration // maximum time to wait for the status
+	Interval time.Duration // delay before the first recheck
+	Backoff  float64       // factor the delay grows by after every recheck, up to MaxPollInterval
+	Jitter   float64       // fraction every delay is randomly spread by in both directions
+	Progress func(state ServiceState)
+}
+
 type ServiceHandler interface {
-	Start(service Service, protocol ProtocolHandler) (int, error)
-	Status(service Service, protocol ProtocolHandler) (int, error)
-	Stop(service Service, protocol ProtocolHandler) (int, error)
-	Search(service Service, protocol ProtocolHandler) ([]string, error)
+	Start(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Status(service Service, protocol ProtocolHandler) (ServiceState, error)
+	StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error)
+	Stop(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error)
+	List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error)
+	Restart(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Reload(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Pause(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Continue(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Logs(service Service, protocol ProtocolHandler, out io.Writer) error
+	Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error)
+	Config(service Service, protocol ProtocolHandler) (ServiceConfig, error)
+	Kill(service Service, protocol ProtocolHandler, pid int) error
+	Install(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Enable(service Service, protocol ProtocolHandler) (ServiceState, error)
+	Disable(service Service, protocol ProtocolHandler) (ServiceState, error)
+	StartType(service Service, protocol ProtocolHandler) (string, error)
 	IsSupported(protocol ProtocolHandler) bool
 }
 
+// ServiceDependencies are the services a service needs and the services that need it,
+// the dependents are listed in the order they have to be stopped
+type ServiceDependencies struct {
+	Dependencies []string
+	Dependents   []string
+}
+
+// ServiceConfig is a handler's view of the service definition
+type ServiceConfig struct {
+	Binary      string
+	Account     string
+	StartType   string
+	Path        string
+	DisplayName string
+}
+
+func (c ServiceConfig) Describe(name string) string {
+
+	lines := []string{fmt.Sprintf("service %s configuration:", name)}
+
+	fields := [][2]string{
+		{"display name", c.DisplayName},
+		{"binary", c.Binary},
+		{"account", c.Account},
+		{"start type", c.StartType},
+		{"path", c.Path},
+	}
+
+	for _, field := range fields {
+		if field[1] != "" {
+			lines = append(lines, fmt.Sprintf("  %s: %s", field[0], field[1]))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ServiceDefinition describes a service to install, the unit file and init script are local files
+type ServiceDefinition struct {
+	UnitFile    string
+	InitScript  string
+	BinPath     string
+	DisplayName string
+	StartType   string
+}
+
+// ServiceEntry is a service found by Search
+type ServiceEntry struct {
+	Name        string
+	DisplayName string
+	State       ServiceState
+}
+
 type ServiceExecServiceHandler struct {
 }
 
-func (r *ServiceExecServiceHandler) Search(service Service, protocol ProtocolHandler) ([]string, error) {
+func (r *ServiceExecServiceHandler) Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
 	log.Info("search for %s service", service.name)
 
+	entries, err := r.List(service, protocol)
+
+	return Search(service, entries, err)
+}
+
+func (r *ServiceExecServiceHandler) List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+
 	cmd := "service --status-all"
 	stdout, err := protocol.Run(service, cmd)
 
-	return Search(service, stdout, err)
+	return parseStatusAll(stdout), err
+}
+
+// parseStatusAll reads the " [ + ]  name" lines of service --status-all on Debian
+// and the "name (pid 1234) is running..." lines the init scripts print on Red Hat
+func parseStatusAll(stdout string) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+	statuses := map[string]int{"+": ServiceStatusStarted, "-": ServiceStatusStopped, "?": ServiceStatusUnknown}
+
+	for _, m := range regexp.MustCompile(`(?m)^\s*\[\s*([+?-])\s*\]\s+(\S+)`).FindAllStringSubmatch(stdout, -1) {
+		entries = append(entries, ServiceEntry{Name: m[2], State: ServiceState{Status: statuses[m[1]]}})
+	}
+
+	rhStatuses := map[string]int{"running": ServiceStatusStarted, "stopped": ServiceStatusStopped, "not running": ServiceStatusStopped, "dead": ServiceStatusFailed}
+	rp := regexp.MustCompile(`(?m)^([\w.@-]+):?\s+(?:\(pid\s+(\d+)[\d ]*\)\s+)?(?:\w+\s+)?(?:is\s+)?(running|stopped|not running|dead)\b`)
+
+	for _, m := range rp.FindAllStringSubmatch(stdout, -1) {
+		state := ServiceState{Status: rhStatuses[m[3]]}
+		state.PID, _ = strconv.Atoi(m[2])
+		entries = append(entries, ServiceEntry{Name: m[1], State: state})
+	}
+
+	return entries
 }
 
-func (r *ServiceExecServiceHandler) Start(service Service, protocol ProtocolHandler) (int, error) {
+func (r *ServiceExecServiceHandler) Start(service Service, protocol ProtocolHandler) (ServiceState, error) {
 	log.Info("starting %s service", service.name)
 	cmd := fmt.Sprintf("service %s start", service.name)
 	cmd = r.AddSudo(cmd, service)
 	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
 }
 
-func (r *ServiceExecServiceHandler) Status(service Service, protocol ProtocolHandler) (int, error) {
+func (r *ServiceExecServiceHandler) Status(service Service, protocol ProtocolHandler) (ServiceState, error) {
 
 	log.Info("determining service %s status", service.name)
 
-	status := ServiceStatusUnknown
 	cmd := fmt.Sprintf("service %s status", service.name)
 	cmd = r.AddSudo(cmd, service)
 
+	if p, ok := protocol.(ExitCodeProtocolHandler); ok {
+
+		stdout, code, err := p.RunExitCode(service, cmd)
+
+		return lsbStatus(parseServiceExecStatus(stdout), code), err
+	}
+
 	stdout, err := protocol.Run(service, cmd)
 
-	if len(stdout) > 0 {
+	return parseServiceExecStatus(stdout), err
+}
+
+// lsbStatus decides the status of an init script by the LSB exit code of its status action, 4 and the codes
+// LSB does not define are unknown. The text is only used without an exit code, for a service that does not exist
+// and for systemd's own status output
+func lsbStatus(state ServiceState, code int) ServiceState {
+
+	if code == NoExitCode || state.Status == ServiceStatusNotFound || regexp.MustCompile(`(?m)^\s*Active: `).MatchString(state.Output) {
+		return state
+	}
+
+	switch code {
+	case 0:
+		state.Status = ServiceStatusStarted
+	case 1, 2:
+		state.Status = ServiceStatusFailed
+	case 3:
+		state.Status = ServiceStatusStopped
+	default:
+		state.Status = ServiceStatusUnknown
+	}
+
+	return state
+}
+
+// StatusAll reads the status of all services from a single service --status-all, init scripts it does not show
+// or shows without a state are asked for their status
+func (r *ServiceExecServiceHandler) StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+	return statusFromList(r, service, names, protocol, false)
+}
+
+// parseServiceExecStatus understands both SysV init script output and the systemctl status
+// output printed when the service command is redirected to systemd
+func parseServiceExecStatus(stdout string) ServiceState {
+
+	state := ServiceState{Status: ServiceStatusUnknown, Output: stdout}
+
+	if len(stdout) == 0 {
+		return state
+	}
+
+	if m := regexp.MustCompile(`(?m)^\s*Active: (\S+)(?: \(([^)]*)\))?(?: since [^;]+; (.+?) ago)?`).FindStringSubmatch(stdout); m != nil {
+
+		state.SubState = m[2]
+		state.Status = systemdStatus(m[1])
+
+		// the host's own "2h 3min ago", its timestamp is in the host's time zone and clock
+		if state.Status == ServiceStatusStarted {
+			state.Uptime = parseSystemdAgo(m[3])
+		}
+
+		if m := regexp.MustCompile(`(?m)^\s*Loaded: \S+ \([^;)]*; ([\w-]+)`).FindStringSubmatch(stdout); m != nil {
+			state.StartType = m[1]
+
+			if state.Status == ServiceStatusStopped && m[1] == "masked" {
+				state.Status = ServiceStatusDisabled
+			}
+		}
+
+		if m := regexp.MustCompile(`(?m)^\W*\S+ - (.+)$`).FindStringSubmatch(stdout); m != nil {
+			state.Description = strings.TrimSpace(m[1])
+		}
+
+	} else {
 
+		rpNotFound := regexp.MustCompile("(unrecognized service)|(could not be found)|(not-found)")
+		rpFailed := regexp.MustCompile("(dead but)|( failed)")
 		rp0 := regexp.MustCompile("( start)|( is running)")
 		rp1 := regexp.MustCompile("( stop)|( not running)")
 
-		if rp0.MatchString(stdout) {
-			status = ServiceStatusStarted
+		if rpNotFound.MatchString(stdout) {
+			state.Status = ServiceStatusNotFound
+		} else if rpFailed.MatchString(stdout) {
+			state.Status = ServiceStatusFailed
+		} else if rp0.MatchString(stdout) {
+			state.Status = ServiceStatusStarted
 		} else if rp1.MatchString(stdout) {
-			status = ServiceStatusStopped
+			state.Status = ServiceStatusStopped
 		}
 	}
 
-	return status, err
+	if m := regexp.MustCompile(`(?i)(?:pid:?\s+|running \()(\d+)`).FindStringSubmatch(stdout); m != nil {
+		state.PID, _ = strconv.Atoi(m[1])
+	}
+
+	return state
 }
 
 func (r *ServiceExecServiceHandler) AddSudo(cmd string, service Service) string {
+	return addSudo(cmd, service)
+}
+
+func addSudo(cmd string, service Service) string {
 
 	if service.sudo != "" {
 		return fmt.Sprintf("echo '%s' | sudo -S %s", service.sudo, cmd)
@@ -69,7 +282,7 @@ func (r *ServiceExecServiceHandler) AddSudo(cmd string, service Service) string
 	}
 }
 
-func (r *ServiceExecServiceHandler) Stop(service Service, protocol ProtocolHandler) (int, error) {
+func (r *ServiceExecServiceHandler) Stop(service Service, protocol ProtocolHandler) (ServiceState, error) {
 	log.Info("stopping %s service", service.name)
 
 	cmd := fmt.Sprintf("service %s stop", service.name)
@@ -77,170 +290,1840 @@ func (r *ServiceExecServiceHandler) Stop(service Service, protocol ProtocolHandl
 	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStopped)
 }
 
-func (r *ServiceExecServiceHandler) IsSupported(protocol ProtocolHandler) bool {
-	return isCommandSupported(protocol, "service")
+func (r *ServiceExecServiceHandler) Restart(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("restarting %s service", service.name)
+
+	// escalating to kill needs separate stop and start steps
+	if service.force || service.killAfter > 0 {
+		return StopThenStart(service, protocol, r)
+	}
+
+	cmd := r.AddSudo(fmt.Sprintf("service %s restart", service.name), service)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
 }
 
-func isCommandSupported(protocol ProtocolHandler, cmd string) bool {
+func (r *ServiceExecServiceHandler) Reload(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("reloading %s service", service.name)
 
-	log.Debug("looking for executable '%s'", cmd)
+	cmd := fmt.Sprintf("service %s reload", service.name)
+	stdout, err := protocol.Run(service, r.AddSudo(cmd, service))
 
-	_, err := protocol.Run(Service{}, cmd)
+	if err == nil && regexp.MustCompile("(?i)(usage:)|(unknown action)|(not supported)|(not implemented)").MatchString(stdout) {
+		err = fmt.Errorf("reload is not supported by the %s init script", service.name)
+	}
 
-	return err == nil
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown, Output: stdout}, err
+	}
+
+	return r.Status(service, protocol)
 }
 
-func checkCommandSupported(stdout string, stderr string) bool {
-	return !(strings.Contains(stdout, "not found") || strings.Contains(stderr, "not found") ||
-		strings.Contains(stdout, "not recognized") || strings.Contains(stderr, "not recognized") ||
-		strings.Contains(stdout, "not exist") || strings.Contains(stderr, "not exist"))
+func (r *ServiceExecServiceHandler) Pause(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("pause", r)
 }
 
-type SambaServiceHandler struct {
+func (r *ServiceExecServiceHandler) Continue(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("continue", r)
 }
 
-func (r *SambaServiceHandler) Search(service Service, protocol ProtocolHandler) ([]string, error) {
-	log.Info("search for %s service", service.name)
-	cmd := fmt.Sprintf("net rpc service list -I %s -U %s%%%s", service.host, service.user, service.password)
+func (r *ServiceExecServiceHandler) Logs(service Service, protocol ProtocolHandler, out io.Writer) error {
+
+	logFile := service.logFile
+	if logFile == "" {
+		logFile = fmt.Sprintf("/var/log/%s.log", service.name)
+	}
+
+	if service.since > 0 {
+		log.Warn("--since is ignored when reading the log file %s", logFile)
+	}
+
+	cmd := fmt.Sprintf("tail -n %d %s", service.lines, logFile)
+	if service.follow {
+		cmd = fmt.Sprintf("tail -n %d -f %s", service.lines, logFile)
+	}
 
+	return protocol.Stream(service, r.AddSudo(cmd, service), out)
+}
+
+func (r *ServiceExecServiceHandler) Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error) {
+
+	var deps ServiceDependencies
+
+	// LSB headers of the init scripts
+	cmd := fmt.Sprintf("sed -n 's/^# Required-Start:[[:space:]]*//p' /etc/init.d/%s", service.name)
 	stdout, err := protocol.Run(service, cmd)
 
-	return Search(service, stdout, err)
+	if err != nil {
+		return deps, err
+	}
+
+	for _, name := range strings.Fields(stdout) {
+		if !strings.HasPrefix(name, "$") {
+			deps.Dependencies = append(deps.Dependencies, name)
+		}
+	}
+
+	cmd = fmt.Sprintf("grep -lE '^# Required-Start:.*[[:space:]]%s([[:space:]]|$)' /etc/init.d/*", regexp.QuoteMeta(service.name))
+	stdout, err = protocol.Run(service, cmd)
+
+	for _, path := range strings.Fields(stdout) {
+		if strings.HasPrefix(path, "/etc/init.d/") {
+			deps.Dependents = append(deps.Dependents, strings.TrimPrefix(path, "/etc/init.d/"))
+		}
+	}
+
+	return deps, err
 }
 
-func (r *SambaServiceHandler) Start(service Service, protocol ProtocolHandler) (int, error) {
-	cmd := fmt.Sprintf("net rpc service start %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
-	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+func (r *ServiceExecServiceHandler) Config(service Service, protocol ProtocolHandler) (ServiceConfig, error) {
+
+	config := ServiceConfig{Path: fmt.Sprintf("/etc/init.d/%s", service.name)}
+
+	cmd := fmt.Sprintf("grep -E '^(# Short-Description:|(DAEMON|DAEMON_USER|USER|RUNAS|EXEC)=)' %s", config.Path)
+	stdout, err := protocol.Run(service, cmd)
+
+	if err != nil {
+		return config, err
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "# Short-Description:") {
+			config.DisplayName = strings.TrimSpace(strings.TrimPrefix(line, "# Short-Description:"))
+		} else if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+
+			value := strings.Trim(kv[1], `"'`)
+
+			switch kv[0] {
+			case "DAEMON", "EXEC":
+				config.Binary = value
+			case "DAEMON_USER", "USER", "RUNAS":
+				config.Account = value
+			}
+		}
+	}
+
+	config.StartType, err = r.StartType(service, protocol)
+
+	return config, err
 }
 
-func (r *SambaServiceHandler) Stop(service Service, protocol ProtocolHandler) (int, error) {
-	cmd := fmt.Sprintf("net rpc service stop %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
-	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStopped)
+func (r *ServiceExecServiceHandler) Kill(service Service, protocol ProtocolHandler, pid int) error {
+
+	if pid <= 0 {
+		return fmt.Errorf("the pid of %s is unknown, it cannot be killed", service.name)
+	}
+
+	_, err := protocol.Run(service, r.AddSudo(fmt.Sprintf("kill -9 %d", pid), service))
+
+	return err
 }
 
-func (r *SambaServiceHandler) Status(service Service, protocol ProtocolHandler) (int, error) {
+func (r *ServiceExecServiceHandler) Install(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("installing %s service", service.name)
 
-	status := ServiceStatusUnknown
+	if service.definition.InitScript == "" {
+		return ServiceState{Status: ServiceStatusUnknown}, fmt.Errorf("installing %s needs an --init-script", service.name)
+	}
+
+	path := fmt.Sprintf("/etc/init.d/%s", service.name)
+
+	if err := uploadDefinition(service, protocol, service.definition.InitScript, path, "755"); err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if service.definition.StartType == "disabled" {
+		return r.Status(service, protocol)
+	}
+
+	return r.Enable(service, protocol)
+}
+
+func (r *ServiceExecServiceHandler) Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("uninstalling %s service", service.name)
+
+	state, err := r.Status(service, protocol)
+
+	if err == nil && !state.Is(ServiceStatusStopped) && !state.Is(ServiceStatusNotFound) {
+		state, err = r.Stop(service, protocol)
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	cmd := fmt.Sprintf("chkconfig --del %s", service.name)
+	if hasCommand(service, protocol, "update-rc.d") {
+		cmd = fmt.Sprintf("update-rc.d -f %s remove", service.name)
+	}
+
+	if _, err = protocol.Run(service, r.AddSudo(cmd, service)); err != nil {
+		return state, err
+	}
+
+	if _, err = protocol.Run(service, r.AddSudo(fmt.Sprintf("rm -f /etc/init.d/%s", service.name), service)); err != nil {
+		return state, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *ServiceExecServiceHandler) Enable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("enabling %s service at boot", service.name)
+
+	cmd := fmt.Sprintf("chkconfig %s on", service.name)
+	if hasCommand(service, protocol, "update-rc.d") {
+		// both steps need root, enable turns a service that was disabled before on again
+		return EnableOrDisable(service, protocol, r, fmt.Sprintf("%s && %s",
+			r.AddSudo(fmt.Sprintf("update-rc.d %s defaults", service.name), service),
+			r.AddSudo(fmt.Sprintf("update-rc.d %s enable", service.name), service)), "enabled")
+	}
+
+	return EnableOrDisable(service, protocol, r, r.AddSudo(cmd, service), "enabled")
+}
+
+func (r *ServiceExecServiceHandler) Disable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("disabling %s service at boot", service.name)
+
+	cmd := fmt.Sprintf("chkconfig %s off", service.name)
+	if hasCommand(service, protocol, "update-rc.d") {
+		cmd = fmt.Sprintf("update-rc.d %s disable", service.name)
+	}
+
+	return EnableOrDisable(service, protocol, r, r.AddSudo(cmd, service), "disabled")
+}
+
+func (r *ServiceExecServiceHandler) StartType(service Service, protocol ProtocolHandler) (string, error) {
+
+	// a start link in one of the multi-user runlevels means the service starts at boot
+	cmd := fmt.Sprintf("ls /etc/rc[2345].d/ /etc/rc.d/rc[2345].d/ 2>/dev/null | grep -c '^S[0-9]*%s$'", service.name)
 
-	cmd := fmt.Sprintf("net rpc service status %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
 	stdout, err := protocol.Run(service, cmd)
 
-	if strings.Contains(stdout, "is running") {
-		status = ServiceStatusStarted
-	} else if strings.Contains(stdout, "is stopped") {
-		status = ServiceStatusStopped
+	// the ssh shell prints its prompt after the count
+	startType := "disabled"
+	if m := regexp.MustCompile(`(?m)^\s*(\d+)\s*$`).FindStringSubmatch(stdout); m != nil {
+		if count, _ := strconv.Atoi(m[1]); count > 0 {
+			startType = "enabled"
+		}
 	}
 
-	return status, err
+	return startType, err
 }
 
-func (r *SambaServiceHandler) IsSupported(protocol ProtocolHandler) bool {
-	return strings.Contains(runtime.GOOS, "linux")
+func (r *ServiceExecServiceHandler) IsSupported(protocol ProtocolHandler) bool {
+	return isCommandSupported(protocol, "service")
 }
 
-type ScExecServiceHandler struct {
-	errorCount int
+// SystemctlServiceHandler manages the units of hosts running systemd
+type SystemctlServiceHandler struct {
 }
 
-func (r *ScExecServiceHandler) Search(service Service, protocol ProtocolHandler) ([]string, error) {
+func (r *SystemctlServiceHandler) Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
 	log.Info("search for %s service", service.name)
 
-	cmd := fmt.Sprintf("wmic /node:'%s' service where (name like '%%%s%%') get name", service.host, service.name)
+	entries, err := r.List(service, protocol)
 
-	stdout, err := protocol.Run(service, cmd)
-	return Search(service, stdout, err)
+	return Search(service, entries, err)
 }
 
-func (r *ScExecServiceHandler) Start(service Service, protocol ProtocolHandler) (int, error) {
-	cmd := fmt.Sprintf("sc \\\\%s start %s", service.host, service.name)
+func (r *SystemctlServiceHandler) List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+
+	cmd := "systemctl list-units --type=service --all --no-pager --no-legend --plain"
+	units, err := protocol.Run(service, cmd)
+
+	var unitFiles string
+	if err == nil {
+		cmd = "systemctl list-unit-files --type=service --no-pager --no-legend"
+		unitFiles, err = protocol.Run(service, cmd)
+	}
+
+	return parseSystemctlUnits(units, unitFiles), err
+}
+
+// parseSystemctlUnits combines the units' state from list-units with their start type from list-unit-files,
+// units that are not loaded are stopped
+func parseSystemctlUnits(units string, unitFiles string) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+	index := map[string]int{}
+
+	for _, line := range strings.Split(units, "\n") {
+
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "●"))
+		if len(fields) < 4 || !strings.HasSuffix(fields[0], ".service") {
+			continue
+		}
+
+		state := ServiceState{Status: systemdStatus(fields[2]), SubState: fields[3]}
+		if fields[1] == "not-found" {
+			state.Status = ServiceStatusNotFound
+		}
+
+		index[fields[0]] = len(entries)
+		entries = append(entries, ServiceEntry{
+			Name:        strings.TrimSuffix(fields[0], ".service"),
+			DisplayName: strings.Join(fields[4:], " "),
+			State:       state})
+	}
+
+	for _, line := range strings.Split(unitFiles, "\n") {
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ".service") {
+			continue
+		}
+
+		i, found := index[fields[0]]
+		if !found {
+			i = len(entries)
+			entries = append(entries, ServiceEntry{Name: strings.TrimSuffix(fields[0], ".service"), State: ServiceState{Status: ServiceStatusStopped}})
+		}
+
+		entries[i].State.StartType = fields[1]
+		if fields[1] == "masked" && entries[i].State.Status == ServiceStatusStopped {
+			entries[i].State.Status = ServiceStatusDisabled
+		}
+	}
+
+	return entries
+}
+
+func (r *SystemctlServiceHandler) Start(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("starting %s service", service.name)
+
+	cmd := addSudo(fmt.Sprintf("systemctl start %s", service.name), service)
 	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
 }
 
-func (r *ScExecServiceHandler) Stop(service Service, protocol ProtocolHandler) (int, error) {
-	cmd := fmt.Sprintf("sc \\\\%s stop %s", service.host, service.name)
+func (r *SystemctlServiceHandler) Stop(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("stopping %s service", service.name)
+
+	cmd := addSudo(fmt.Sprintf("systemctl stop %s", service.name), service)
 	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStopped)
 }
 
-func (r *ScExecServiceHandler) Status(service Service, protocol ProtocolHandler) (int, error) {
+func (r *SystemctlServiceHandler) Status(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("determining service %s status", service.name)
+
+	cmd := fmt.Sprintf("cat /proc/uptime; systemctl show %s --no-pager -p %s", service.name, systemctlShowProperties)
+	stdout, err := protocol.Run(service, cmd)
+
+	return parseSystemctlShow(stdout, parseBootUptime(stdout)), err
+}
 
-	status := ServiceStatusUnknown
-	cmd := fmt.Sprintf("sc \\\\%s query %s", service.host, service.name)
+// StatusAll shows all units with a single systemctl show, which separates the units by an empty line
+func (r *SystemctlServiceHandler) StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+	log.Info("determining status of %d services", len(names))
 
+	cmd := fmt.Sprintf("cat /proc/uptime; systemctl show %s --no-pager -p %s", strings.Join(names, " "), systemctlShowProperties)
 	stdout, err := protocol.Run(service, cmd)
+	bootUptime := parseBootUptime(stdout)
 
-	// windows returns right away, give it some time to update the service's status
-	time.Sleep(time.Duration(1000) * time.Millisecond)
+	blocks := regexp.MustCompile(`\r?\n[ \t]*\r?\n`).Split(strings.TrimSpace(stdout), -1)
 
-	if strings.Contains(stdout, "_PENDING") {
-		if r.errorCount < 60 {
-			fmt.Print(".")
-			time.Sleep(time.Duration(500) * time.Millisecond)
-			r.errorCount++
+	if err == nil && len(blocks) != len(names) {
+		err = fmt.Errorf("systemctl show returned %d units for %d services", len(blocks), len(names))
+	}
 
-			status, err = r.Status(service, protocol)
-		}
-	} else if strings.Contains(stdout, "RUNNING") {
-		status = ServiceStatusStarted
-	} else if strings.Contains(stdout, "STOPPED") {
-		status = ServiceStatusStopped
+	states := []ServiceState{}
+	for i := 0; i < len(names) && err == nil; i++ {
+		states = append(states, parseSystemctlShow(blocks[i], bootUptime))
 	}
 
-	return status, err
+	return states, err
 }
 
-func (r *ScExecServiceHandler) IsSupported(protocol ProtocolHandler) bool {
-	return strings.Contains(runtime.GOOS, "windows")
+// properties of systemctl show that make up the state of a unit
+const systemctlShowProperties string = "LoadState,ActiveState,SubState,MainPID,UnitFileState,Description,ActiveEnterTimestampMonotonic"
+
+func parseSystemctlShow(stdout string, bootUptime time.Duration) ServiceState {
+
+	state := ServiceState{Status: ServiceStatusUnknown, Output: stdout}
+	props := map[string]string{}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		if kv := strings.SplitN(strings.TrimSpace(line), "=", 2); len(kv) == 2 {
+			props[kv[0]] = kv[1]
+		}
+	}
+
+	state.Status = systemdStatus(props["ActiveState"])
+
+	if props["LoadState"] == "not-found" {
+		state.Status = ServiceStatusNotFound
+	} else if props["LoadState"] == "masked" && state.Status == ServiceStatusStopped {
+		state.Status = ServiceStatusDisabled
+	}
+
+	state.SubState = props["SubState"]
+	state.StartType = props["UnitFileState"]
+	state.Description = props["Description"]
+	state.PID, _ = strconv.Atoi(props["MainPID"])
+
+	// both clocks count from the host's boot, so neither its time zone nor its clock matter
+	entered, _ := strconv.ParseInt(props["ActiveEnterTimestampMonotonic"], 10, 64)
+	if entered > 0 && bootUptime > 0 && state.Status == ServiceStatusStarted {
+		state.Uptime = (bootUptime - time.Duration(entered)*time.Microsecond).Truncate(time.Second)
+	}
+
+	return state
 }
 
-func StartOrStopWithRetry(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, cmd string, wantedStatus int) (int, error) {
+// parseBootUptime reads the seconds since boot of /proc/uptime, the systemctl show commands print it first
+func parseBootUptime(stdout string) time.Duration {
 
-	var err error
-	status := ServiceStatusUnknown
+	if m := regexp.MustCompile(`(?m)^(\d+(?:\.\d+)?) \d+(?:\.\d+)?\s*$`).FindStringSubmatch(stdout); m != nil {
+		seconds, _ := strconv.ParseFloat(m[1], 64)
+		return time.Duration(seconds * float64(time.Second))
+	}
 
-	_, retErr := protocol.Run(service, cmd)
+	return 0
+}
 
-	i := 0
-	for status != wantedStatus {
+// units of the relative times systemd prints, e.g. "1 day 2h" or "3 months 5 days"
+var systemdAgoUnits = map[string]time.Duration{
+	"y": 31557600 * time.Second, "year": 31557600 * time.Second, "years": 31557600 * time.Second,
+	"month": 2629800 * time.Second, "months": 2629800 * time.Second,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"h": time.Hour, "min": time.Minute, "s": time.Second, "ms": time.Millisecond, "us": time.Microsecond,
+}
 
-		status, err = serviceHandler.Status(service, protocol)
+// parseSystemdAgo reads the time systemctl status shows before "ago"
+func parseSystemdAgo(ago string) time.Duration {
 
-		// set retErr to error from status only if it's never been set
-		// or call to Status returned no error
-		if retErr == nil || err == nil {
-			retErr = err
-		}
+	var d time.Duration
 
-		if i == 30 || retErr != nil {
-			status = ServiceStatusUnknown
-			break
-		} else {
-			fmt.Print(".")
-			time.Sleep(time.Duration(1000) * time.Millisecond)
-			i++
-		}
+	for _, m := range regexp.MustCompile(`(\d+)\s*([a-z]+)`).FindAllStringSubmatch(ago, -1) {
+		n, _ := strconv.Atoi(m[1])
+		d += time.Duration(n) * systemdAgoUnits[m[2]]
 	}
 
-	return status, retErr
+	return d.Truncate(time.Second)
 }
 
-func Search(service Service, stdout string, err error) ([]string, error) {
+// systemdStatus maps a unit's ActiveState to its status
+func systemdStatus(active string) int {
+
+	switch active {
+	case "active", "reloading":
+		return ServiceStatusStarted
+	case "activating":
+		return ServiceStatusStarting
+	case "deactivating":
+		return ServiceStatusStopping
+	case "failed":
+		return ServiceStatusFailed
+	case "inactive":
+		return ServiceStatusStopped
+	}
+
+	return ServiceStatusUnknown
+}
 
-	list := []string{}
+func (r *SystemctlServiceHandler) Restart(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("restarting %s service", service.name)
 
-	if err == nil {
+	// escalating to kill needs separate stop and start steps
+	if service.force || service.killAfter > 0 {
+		return StopThenStart(service, protocol, r)
+	}
+
+	cmd := addSudo(fmt.Sprintf("systemctl restart %s", service.name), service)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+}
 
-		rp := regexp.MustCompile(fmt.Sprintf(".*%s.*", service.name))
+func (r *SystemctlServiceHandler) Reload(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("reloading %s service", service.name)
 
-		strs := strings.Split(stdout, "\n")
+	cmd := fmt.Sprintf("systemctl reload %s", service.name)
+	if service.reloadOrRestart {
+		cmd = fmt.Sprintf("systemctl reload-or-restart %s", service.name)
+	}
 
-		for _, element := range strs {
+	stdout, err := protocol.Run(service, addSudo(cmd, service))
 
-			if rp.MatchString(element) {
-				list = append(list, strings.Trim(element, " "))
-			}
-		}
+	if err == nil && strings.Contains(stdout, "Failed") {
+		err = fmt.Errorf("reload of %s failed: %s", service.name, strings.TrimSpace(stdout))
 	}
 
-	return list, err
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown, Output: stdout}, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SystemctlServiceHandler) Pause(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("pause", r)
+}
+
+func (r *SystemctlServiceHandler) Continue(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("continue", r)
+}
+
+func (r *SystemctlServiceHandler) Logs(service Service, protocol ProtocolHandler, out io.Writer) error {
+
+	cmd := fmt.Sprintf("journalctl -u %s --no-pager -n %d", service.name, service.lines)
+
+	if service.since > 0 {
+		cmd = fmt.Sprintf("%s --since=-%ds", cmd, int(service.since.Seconds()))
+	}
+
+	if service.follow {
+		cmd = fmt.Sprintf("%s -f", cmd)
+	}
+
+	return protocol.Stream(service, addSudo(cmd, service), out)
+}
+
+func (r *SystemctlServiceHandler) Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error) {
+
+	var deps ServiceDependencies
+
+	cmd := fmt.Sprintf("systemctl list-dependencies %s --plain --no-pager", service.name)
+	stdout, err := protocol.Run(service, cmd)
+
+	if err != nil {
+		return deps, err
+	}
+
+	deps.Dependencies = parseSystemctlDependencies(stdout, false)
+
+	cmd = fmt.Sprintf("systemctl list-dependencies %s --reverse --plain --no-pager", service.name)
+	stdout, err = protocol.Run(service, cmd)
+
+	deps.Dependents = parseSystemctlDependencies(stdout, true)
+
+	return deps, err
+}
+
+// parseSystemctlDependencies returns the services of a list-dependencies tree,
+// deepest first when they are used for stopping
+func parseSystemctlDependencies(stdout string, deepestFirst bool) []string {
+
+	type unit struct {
+		name  string
+		depth int
+	}
+
+	units := []unit{}
+	seen := map[string]bool{}
+
+	// the first line is the unit itself
+	for _, line := range strings.Split(stdout, "\n")[1:] {
+
+		name := strings.TrimSpace(line)
+		if !strings.HasSuffix(name, ".service") {
+			continue
+		}
+
+		name = strings.TrimSuffix(name, ".service")
+		if !seen[name] {
+			seen[name] = true
+			units = append(units, unit{name, len(line) - len(strings.TrimLeft(line, " "))})
+		}
+	}
+
+	if deepestFirst {
+		sort.SliceStable(units, func(i, j int) bool { return units[i].depth > units[j].depth })
+	}
+
+	names := []string{}
+	for _, u := range units {
+		names = append(names, u.name)
+	}
+
+	return names
+}
+
+func (r *SystemctlServiceHandler) Config(service Service, protocol ProtocolHandler) (ServiceConfig, error) {
+
+	cmd := fmt.Sprintf("systemctl show %s --no-pager -p ExecStart,User,FragmentPath,UnitFileState,Description", service.name)
+	stdout, err := protocol.Run(service, cmd)
+
+	config := ServiceConfig{}
+
+	for _, line := range strings.Split(stdout, "\n") {
+
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "ExecStart":
+			// { path=/usr/sbin/nginx ; argv[]=/usr/sbin/nginx -g daemon on; ; ignore_errors=no ; ... }
+			if m := regexp.MustCompile(`argv\[\]=(.*?) ; `).FindStringSubmatch(kv[1]); m != nil {
+				config.Binary = m[1]
+			}
+		case "User":
+			config.Account = kv[1]
+		case "FragmentPath":
+			config.Path = kv[1]
+		case "UnitFileState":
+			config.StartType = kv[1]
+		case "Description":
+			config.DisplayName = kv[1]
+		}
+	}
+
+	if config.Account == "" && config.Binary != "" {
+		config.Account = "root"
+	}
+
+	return config, err
+}
+
+func (r *SystemctlServiceHandler) Kill(service Service, protocol ProtocolHandler, pid int) error {
+
+	_, err := protocol.Run(service, addSudo(fmt.Sprintf("systemctl kill -s KILL %s", service.name), service))
+
+	return err
+}
+
+func (r *SystemctlServiceHandler) Install(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("installing %s service", service.name)
+
+	if service.definition.UnitFile == "" {
+		return ServiceState{Status: ServiceStatusUnknown}, fmt.Errorf("installing %s needs a --unit-file", service.name)
+	}
+
+	path := fmt.Sprintf("/etc/systemd/system/%s.service", service.name)
+
+	if err := uploadDefinition(service, protocol, service.definition.UnitFile, path, "644"); err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if _, err := protocol.Run(service, addSudo("systemctl daemon-reload", service)); err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if service.definition.StartType == "disabled" {
+		return r.Status(service, protocol)
+	}
+
+	return r.Enable(service, protocol)
+}
+
+func (r *SystemctlServiceHandler) Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("uninstalling %s service", service.name)
+
+	cmds := []string{
+		fmt.Sprintf("systemctl disable --now %s", service.name),
+		fmt.Sprintf("rm -f /etc/systemd/system/%s.service", service.name),
+		"systemctl daemon-reload",
+	}
+
+	for _, cmd := range cmds {
+		if _, err := protocol.Run(service, addSudo(cmd, service)); err != nil {
+			return ServiceState{Status: ServiceStatusUnknown}, err
+		}
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SystemctlServiceHandler) Enable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("enabling %s service at boot", service.name)
+
+	cmd := fmt.Sprintf("systemctl enable %s", service.name)
+	if service.now {
+		cmd = fmt.Sprintf("systemctl enable --now %s", service.name)
+	}
+
+	_, err := protocol.Run(service, addSudo(cmd, service))
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SystemctlServiceHandler) Disable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("disabling %s service at boot", service.name)
+
+	cmd := fmt.Sprintf("systemctl disable %s", service.name)
+	if service.now {
+		cmd = fmt.Sprintf("systemctl disable --now %s", service.name)
+	}
+
+	_, err := protocol.Run(service, addSudo(cmd, service))
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SystemctlServiceHandler) StartType(service Service, protocol ProtocolHandler) (string, error) {
+
+	state, err := r.Status(service, protocol)
+
+	return state.StartType, err
+}
+
+func (r *SystemctlServiceHandler) IsSupported(protocol ProtocolHandler) bool {
+
+	// systemctl has to run on the target host, not on the local machine
+	if _, remote := protocol.(*SSHProtocolHandler); !remote {
+		return false
+	}
+
+	log.Debug("looking for executable 'systemctl'")
+
+	stdout, err := protocol.Run(Service{}, "systemctl --version")
+
+	return err == nil && strings.Contains(stdout, "systemd") && checkCommandSupported(stdout, "")
+}
+
+// hasCommand reports whether cmd is found on the target's PATH
+func hasCommand(service Service, protocol ProtocolHandler, cmd string) bool {
+
+	stdout, err := protocol.Run(service, fmt.Sprintf("command -v %s", cmd))
+
+	return err == nil && strings.Contains(stdout, cmd) && checkCommandSupported(stdout, "")
+}
+
+func isCommandSupported(protocol ProtocolHandler, cmd string) bool {
+
+	log.Debug("looking for executable '%s'", cmd)
+
+	_, err := protocol.Run(Service{}, cmd)
+
+	return err == nil
+}
+
+func checkCommandSupported(stdout string, stderr string) bool {
+	return !(strings.Contains(stdout, "not found") || strings.Contains(stderr, "not found") ||
+		strings.Contains(stdout, "not recognized") || strings.Contains(stderr, "not recognized") ||
+		strings.Contains(stdout, "not exist") || strings.Contains(stderr, "not exist"))
+}
+
+type SambaServiceHandler struct {
+}
+
+func (r *SambaServiceHandler) Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+	log.Info("search for %s service", service.name)
+
+	entries, err := r.List(service, protocol)
+
+	return Search(service, entries, err)
+}
+
+func (r *SambaServiceHandler) List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+
+	cmd := fmt.Sprintf("net rpc service list -I %s -U %s%%%s", service.host, service.user, service.password)
+
+	stdout, err := protocol.Run(service, cmd)
+
+	return parseSambaList(stdout), err
+}
+
+// parseSambaList reads the name "display name" lines of net rpc service list, which has no state
+func parseSambaList(stdout string) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+
+	for _, m := range regexp.MustCompile(`(?m)^\s*(\S+)\s+"([^"]*)"`).FindAllStringSubmatch(stdout, -1) {
+		entries = append(entries, ServiceEntry{Name: m[1], DisplayName: m[2], State: ServiceState{Status: ServiceStatusUnknown}})
+	}
+
+	return entries
+}
+
+func (r *SambaServiceHandler) Start(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("net rpc service start %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+}
+
+func (r *SambaServiceHandler) Stop(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("net rpc service stop %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStopped)
+}
+
+// StatusAll asks for every service on its own, net rpc service list has no state
+func (r *SambaServiceHandler) StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+	return statusEach(r, service, names, protocol)
+}
+
+func (r *SambaServiceHandler) Status(service Service, protocol ProtocolHandler) (ServiceState, error) {
+
+	cmd := fmt.Sprintf("net rpc service status %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+	stdout, err := protocol.Run(service, cmd)
+
+	return parseSambaStatus(stdout), err
+}
+
+var sambaStartTypes = map[string]string{
+	"0x0": "boot",
+	"0x1": "system",
+	"0x2": "auto",
+	"0x3": "demand",
+	"0x4": "disabled",
+}
+
+func parseSambaStatus(stdout string) ServiceState {
+
+	state := ServiceState{Status: ServiceStatusUnknown, Output: stdout}
+
+	if strings.Contains(stdout, "is running") {
+		state.Status = ServiceStatusStarted
+	} else if strings.Contains(stdout, "is stopped") {
+		state.Status = ServiceStatusStopped
+	} else if strings.Contains(stdout, "is start pending") {
+		state.Status = ServiceStatusStarting
+	} else if strings.Contains(stdout, "is stop pending") {
+		state.Status = ServiceStatusStopping
+	} else if strings.Contains(stdout, "is pause pending") {
+		state.Status = ServiceStatusPausing
+	} else if strings.Contains(stdout, "is resume pending") {
+		state.Status = ServiceStatusResuming
+	} else if strings.Contains(stdout, "is paused") {
+		state.Status = ServiceStatusPaused
+	} else if strings.Contains(stdout, "NO_SUCH_SERVICE") || strings.Contains(stdout, "DOES_NOT_EXIST") {
+		state.Status = ServiceStatusNotFound
+	}
+
+	if m := regexp.MustCompile(`Start Type\s+=\s+(0x\d)`).FindStringSubmatch(stdout); m != nil {
+		state.StartType = sambaStartTypes[m[1]]
+
+		if state.Status == ServiceStatusStopped && state.StartType == "disabled" {
+			state.Status = ServiceStatusDisabled
+		}
+	}
+
+	if m := regexp.MustCompile(`Display Name\s+=\s*(.*)`).FindStringSubmatch(stdout); m != nil {
+		state.Description = strings.TrimSpace(m[1])
+	}
+
+	return state
+}
+
+func (r *SambaServiceHandler) Restart(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return StopThenStart(service, protocol, r)
+}
+
+func (r *SambaServiceHandler) Reload(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("reload", r)
+}
+
+func (r *SambaServiceHandler) Pause(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("net rpc service pause %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusPaused)
+}
+
+func (r *SambaServiceHandler) Continue(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("net rpc service resume %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+}
+
+func (r *SambaServiceHandler) Logs(service Service, protocol ProtocolHandler, out io.Writer) error {
+	return notSupported("logs", r)
+}
+
+func (r *SambaServiceHandler) Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error) {
+
+	var deps ServiceDependencies
+
+	state, err := r.Status(service, protocol)
+
+	if m := regexp.MustCompile(`Dependencies\s+=\s*(.*)`).FindStringSubmatch(state.Output); m != nil {
+		for _, name := range strings.Split(m[1], "/") {
+			if name = strings.TrimSpace(name); name != "" {
+				deps.Dependencies = append(deps.Dependencies, name)
+			}
+		}
+	}
+
+	log.Warn("the dependents of %s cannot be determined using net rpc", service.name)
+
+	return deps, err
+}
+
+func (r *SambaServiceHandler) Config(service Service, protocol ProtocolHandler) (ServiceConfig, error) {
+
+	state, err := r.Status(service, protocol)
+
+	config := ServiceConfig{StartType: state.StartType, DisplayName: state.Description}
+
+	if m := regexp.MustCompile(`Executable Path\s+=[ \t]*(.*)`).FindStringSubmatch(state.Output); m != nil {
+		config.Binary = strings.TrimSpace(m[1])
+	}
+
+	if m := regexp.MustCompile(`Start Name\s+=[ \t]*(.*)`).FindStringSubmatch(state.Output); m != nil {
+		config.Account = strings.TrimSpace(m[1])
+	}
+
+	return config, err
+}
+
+func (r *SambaServiceHandler) Kill(service Service, protocol ProtocolHandler, pid int) error {
+	return notSupported("kill", r)
+}
+
+func (r *SambaServiceHandler) Install(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("installing %s service", service.name)
+
+	if service.definition.BinPath == "" {
+		return ServiceState{Status: ServiceStatusUnknown}, fmt.Errorf("installing %s needs a --bin-path", service.name)
+	}
+
+	displayName := service.definition.DisplayName
+	if displayName == "" {
+		displayName = service.name
+	}
+
+	cmd := fmt.Sprintf("net rpc service create %s \"%s\" \"%s\" -I %s -U %s%%%s", service.name, displayName, service.definition.BinPath, service.host, service.user, service.password)
+
+	if _, err := protocol.Run(service, cmd); err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if service.now {
+		return r.Start(service, protocol)
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SambaServiceHandler) Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("uninstalling %s service", service.name)
+
+	state, err := r.Status(service, protocol)
+
+	if err == nil && !state.Is(ServiceStatusStopped) && !state.Is(ServiceStatusNotFound) {
+		state, err = r.Stop(service, protocol)
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	cmd := fmt.Sprintf("net rpc service delete %s -I %s -U %s%%%s", service.name, service.host, service.user, service.password)
+
+	if _, err = protocol.Run(service, cmd); err != nil {
+		return state, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *SambaServiceHandler) Enable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("enable", r)
+}
+
+func (r *SambaServiceHandler) Disable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("disable", r)
+}
+
+func (r *SambaServiceHandler) StartType(service Service, protocol ProtocolHandler) (string, error) {
+
+	state, err := r.Status(service, protocol)
+
+	return state.StartType, err
+}
+
+func (r *SambaServiceHandler) IsSupported(protocol ProtocolHandler) bool {
+	return strings.Contains(runtime.GOOS, "linux")
+}
+
+type ScExecServiceHandler struct {
+}
+
+func (r *ScExecServiceHandler) Search(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+	log.Info("search for %s service", service.name)
+
+	cmd := fmt.Sprintf("wmic /node:'%s' service get Name,DisplayName,State,StartMode /format:csv", service.host)
+
+	stdout, err := protocol.Run(service, cmd)
+	return Search(service, parseWmicServices(stdout), err)
+}
+
+// List uses sc query, which shows the state of every service but not its start type
+func (r *ScExecServiceHandler) List(service Service, protocol ProtocolHandler) ([]ServiceEntry, error) {
+
+	cmd := fmt.Sprintf("sc \\\\%s query state= all", service.host)
+
+	stdout, err := protocol.Run(service, cmd)
+
+	return parseScQuery(stdout), err
+}
+
+// parseScQuery splits the listing of sc query into the blocks of the services, a block starts with the
+// service's name and display name, the only lines with an upper case label that are not indented
+func parseScQuery(stdout string) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+	texts := []string{}
+
+	rpTop := regexp.MustCompile(`^(\p{Lu}[\p{Lu}_]*):\s*(.*?)\s*$`)
+	named := false
+
+	for _, line := range strings.Split(stdout, "\n") {
+
+		if m := rpTop.FindStringSubmatch(strings.TrimRight(line, "\r")); m != nil {
+
+			if named {
+				entries[len(entries)-1].DisplayName = m[2]
+			} else {
+				entries = append(entries, ServiceEntry{Name: m[2]})
+				texts = append(texts, "")
+			}
+
+			named = !named
+			continue
+		}
+
+		if strings.TrimSpace(line) != "" {
+			named = false
+		}
+
+		if len(texts) > 0 {
+			texts[len(texts)-1] += line + "\n"
+		}
+	}
+
+	for i := range entries {
+		entries[i].State = parseScStatus(texts[i])
+		entries[i].State.Output = ""
+	}
+
+	return entries
+}
+
+var wmicStatuses = map[string]int{
+	"Running":          ServiceStatusStarted,
+	"Stopped":          ServiceStatusStopped,
+	"Start Pending":    ServiceStatusStarting,
+	"Stop Pending":     ServiceStatusStopping,
+	"Paused":           ServiceStatusPaused,
+	"Pause Pending":    ServiceStatusPausing,
+	"Continue Pending": ServiceStatusResuming,
+}
+
+// parseWmicServices reads the csv listing of wmic service get, its columns are found by the header
+func parseWmicServices(stdout string) []ServiceEntry {
+
+	entries := []ServiceEntry{}
+	columns := map[string]int{}
+
+	for _, line := range strings.Split(stdout, "\n") {
+
+		fields := strings.Split(strings.TrimSpace(line), ",")
+
+		if len(columns) == 0 {
+			if len(fields) > 1 {
+				for i, name := range fields {
+					columns[name] = i
+				}
+			}
+			continue
+		}
+
+		if len(fields) != len(columns) {
+			continue
+		}
+
+		state := ServiceState{Status: ServiceStatusUnknown, StartType: fields[columns["StartMode"]]}
+		if status, found := wmicStatuses[fields[columns["State"]]]; found {
+			state.Status = status
+		}
+
+		if state.Status == ServiceStatusStopped && state.StartType == "Disabled" {
+			state.Status = ServiceStatusDisabled
+		}
+
+		entries = append(entries, ServiceEntry{Name: fields[columns["Name"]], DisplayName: fields[columns["DisplayName"]], State: state})
+	}
+
+	return entries
+}
+
+func (r *ScExecServiceHandler) Start(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s start %s", service.host, service.name)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+}
+
+func (r *ScExecServiceHandler) Stop(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s stop %s", service.host, service.name)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStopped)
+}
+
+func (r *ScExecServiceHandler) Status(service Service, protocol ProtocolHandler) (ServiceState, error) {
+
+	cmd := fmt.Sprintf("sc \\\\%s queryex %s", service.host, service.name)
+
+	stdout, err := protocol.Run(service, cmd)
+
+	// windows returns right away, give it some time to update the service's status
+	time.Sleep(service.wait.StatusDelay)
+
+	return parseScStatus(stdout), err
+}
+
+// states of sc by their numeric code, which is the same in every language of windows
+var scStates = map[string]int{
+	"1": ServiceStatusStopped,
+	"2": ServiceStatusStarting,
+	"3": ServiceStatusStopping,
+	"4": ServiceStatusStarted,
+	"5": ServiceStatusResuming,
+	"6": ServiceStatusPausing,
+	"7": ServiceStatusPaused,
+}
+
+// StatusAll reads the status of all services from a single sc query listing
+func (r *ScExecServiceHandler) StatusAll(service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+	return statusFromList(r, service, names, protocol, true)
+}
+
+func parseScStatus(stdout string) ServiceState {
+
+	state := ServiceState{Status: ServiceStatusUnknown, Output: stdout}
+
+	// the labels of sc are translated, the state is found by its numeric code followed by its name
+	rpState := regexp.MustCompile(`(?m)^\s+[^:\r\n]+:\s+([1-7])\s+(STOPPED|START_PENDING|STOP_PENDING|RUNNING|CONTINUE_PENDING|PAUSE_PENDING|PAUSED)\b`)
+
+	if m := rpState.FindStringSubmatch(stdout); m != nil {
+		state.SubState = m[2]
+		state.Status = scStates[m[1]]
+	} else if strings.Contains(stdout, "1060") {
+		state.Status = ServiceStatusNotFound
+	}
+
+	// the pid is the only plain number of queryex
+	if m := regexp.MustCompile(`(?m)^\s+[^:\r\n]+:\s+(\d+)\s*$`).FindStringSubmatch(stdout); m != nil {
+		state.PID, _ = strconv.Atoi(m[1])
+	}
+
+	return state
+}
+
+func (r *ScExecServiceHandler) Restart(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return StopThenStart(service, protocol, r)
+}
+
+func (r *ScExecServiceHandler) Reload(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	return ServiceState{Status: ServiceStatusUnknown}, notSupported("reload", r)
+}
+
+func (r *ScExecServiceHandler) Pause(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s pause %s", service.host, service.name)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusPaused)
+}
+
+func (r *ScExecServiceHandler) Continue(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s continue %s", service.host, service.name)
+	return StartOrStopWithRetry(service, protocol, r, cmd, ServiceStatusStarted)
+}
+
+func (r *ScExecServiceHandler) Logs(service Service, protocol ProtocolHandler, out io.Writer) error {
+
+	if service.follow {
+		return notSupported("logs --follow", r)
+	}
+
+	// the query must not contain spaces, the command is split on whitespace
+	query := fmt.Sprintf("*[System[Provider[@Name='%s']]", service.name)
+	if service.since > 0 {
+		query = fmt.Sprintf("%s[TimeCreated[timediff(@SystemTime)<=%d]]", query, service.since.Milliseconds())
+	}
+	query += "]"
+
+	cmd := fmt.Sprintf("wevtutil qe Application /q:%s /c:%d /rd:true /f:text /r:%s", query, service.lines, service.host)
+
+	return protocol.Stream(service, cmd, out)
+}
+
+func (r *ScExecServiceHandler) Enable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s config %s start= auto", service.host, service.name)
+	return EnableOrDisable(service, protocol, r, cmd, "auto")
+}
+
+func (r *ScExecServiceHandler) Disable(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	cmd := fmt.Sprintf("sc \\\\%s config %s start= disabled", service.host, service.name)
+	return EnableOrDisable(service, protocol, r, cmd, "disabled")
+}
+
+func (r *ScExecServiceHandler) Dependencies(service Service, protocol ProtocolHandler) (ServiceDependencies, error) {
+
+	var deps ServiceDependencies
+
+	cmd := fmt.Sprintf("sc \\\\%s qc %s", service.host, service.name)
+	stdout, err := protocol.Run(service, cmd)
+
+	if err != nil {
+		return deps, err
+	}
+
+	// DEPENDENCIES       : RPCSS
+	//                    : Tcpip
+	for _, dependency := range scConfigFields(stdout).values("DEPENDENCIES", scConfigDependencies) {
+		if dependency != "" {
+			deps.Dependencies = append(deps.Dependencies, dependency)
+		}
+	}
+
+	// enumdepend lists the dependents in the order they have to be stopped
+	cmd = fmt.Sprintf("sc \\\\%s enumdepend %s", service.host, service.name)
+	stdout, err = protocol.Run(service, cmd)
+
+	for _, entry := range parseScQuery(stdout) {
+		deps.Dependents = append(deps.Dependents, entry.Name)
+	}
+
+	return deps, err
+}
+
+func (r *ScExecServiceHandler) Kill(service Service, protocol ProtocolHandler, pid int) error {
+
+	if pid <= 0 {
+		return fmt.Errorf("the pid of %s is unknown, it cannot be killed", service.name)
+	}
+
+	_, err := protocol.Run(service, fmt.Sprintf("taskkill /S %s /F /PID %d", service.host, pid))
+
+	return err
+}
+
+func (r *ScExecServiceHandler) Install(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("installing %s service", service.name)
+
+	if service.definition.BinPath == "" {
+		return ServiceState{Status: ServiceStatusUnknown}, fmt.Errorf("installing %s needs a --bin-path", service.name)
+	}
+
+	displayName := service.definition.DisplayName
+	if displayName == "" {
+		displayName = service.name
+	}
+
+	startType := service.definition.StartType
+	if startType == "" {
+		startType = "auto"
+	}
+
+	cmd := fmt.Sprintf("sc \\\\%s create %s binPath= \"%s\" DisplayName= \"%s\" start= %s", service.host, service.name, service.definition.BinPath, displayName, startType)
+
+	if _, err := protocol.Run(service, cmd); err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if service.now {
+		return r.Start(service, protocol)
+	}
+
+	return r.Status(service, protocol)
+}
+
+func (r *ScExecServiceHandler) Uninstall(service Service, protocol ProtocolHandler) (ServiceState, error) {
+	log.Info("uninstalling %s service", service.name)
+
+	state, err := r.Status(service, protocol)
+
+	if err == nil && !state.Is(ServiceStatusStopped) && !state.Is(ServiceStatusNotFound) {
+		state, err = r.Stop(service, protocol)
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	if _, err = protocol.Run(service, fmt.Sprintf("sc \\\\%s delete %s", service.host, service.name)); err != nil {
+		return state, err
+	}
+
+	return r.Status(service, protocol)
+}
+
+// start types of sc by their numeric code
+var scStartTypeCodes = map[string]string{
+	"0": "boot",
+	"1": "system",
+	"2": "auto",
+	"3": "demand",
+	"4": "disabled",
+}
+
+func (r *ScExecServiceHandler) StartType(service Service, protocol ProtocolHandler) (string, error) {
+
+	config, err := r.Config(service, protocol)
+
+	return config.StartType, err
+}
+
+func (r *ScExecServiceHandler) Config(service Service, protocol ProtocolHandler) (ServiceConfig, error) {
+
+	cmd := fmt.Sprintf("sc \\\\%s qc %s", service.host, service.name)
+	stdout, err := protocol.Run(service, cmd)
+
+	return parseScConfig(stdout), err
+}
+
+func parseScConfig(stdout string) ServiceConfig {
+
+	config := ServiceConfig{}
+
+	rpStartType := regexp.MustCompile(`(?m)^\s+[^:\r\n]+:\s+([0-4])\s+(?:BOOT_START|SYSTEM_START|AUTO_START|DEMAND_START|DISABLED)(\s+\(DELAYED\))?`)
+
+	if m := rpStartType.FindStringSubmatch(stdout); m != nil {
+		config.StartType = scStartTypeCodes[m[1]]
+
+		if m[2] != "" {
+			config.StartType = "delayed-auto"
+		}
+	}
+
+	fields := scConfigFields(stdout)
+
+	config.Binary = fields.value("BINARY_PATH_NAME", scConfigBinary)
+	config.DisplayName = fields.value("DISPLAY_NAME", scConfigDisplayName)
+	config.Account = fields.value("SERVICE_START_NAME", scConfigAccount)
+
+	return config
+}
+
+// positions of the fields of sc qc, whose labels are translated but whose order is the same in every language of windows
+const (
+	scConfigBinary       = 3
+	scConfigDisplayName  = 6
+	scConfigDependencies = 7
+	scConfigAccount      = 8
+)
+
+// scField is a "label : value" field of sc qc, the values of the lines continuing it follow its own
+type scField struct {
+	label  string
+	values []string
+}
+
+type scFields []scField
+
+// scConfigFields reads the indented fields of sc qc in their order, a line without a label continues the field before it
+func scConfigFields(stdout string) scFields {
+
+	fields := scFields{}
+	rp := regexp.MustCompile(`^\s+([^:]*?)\s*:[ \t]*(.*?)\s*$`)
+
+	for _, line := range strings.Split(stdout, "\n") {
+
+		m := rp.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+
+		if m[1] == "" && len(fields) > 0 {
+			fields[len(fields)-1].values = append(fields[len(fields)-1].values, m[2])
+		} else {
+			fields = append(fields, scField{label: m[1], values: []string{m[2]}})
+		}
+	}
+
+	return fields
+}
+
+// values finds a field by its english label, translated output by the field's position
+func (fields scFields) values(label string, position int) []string {
+
+	for _, field := range fields {
+		if field.label == label {
+			return field.values
+		}
+	}
+
+	// the english labels are missing, the output is translated
+	if len(fields) > position && len(fields) > scConfigAccount {
+		return fields[position].values
+	}
+
+	return nil
+}
+
+func (fields scFields) value(label string, position int) string {
+
+	if values := fields.values(label, position); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (r *ScExecServiceHandler) IsSupported(protocol ProtocolHandler) bool {
+	return strings.Contains(runtime.GOOS, "windows")
+}
+
+func StartOrStopWithRetry(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, cmd string, wantedStatus int) (ServiceState, error) {
+
+	_, retErr := protocol.Run(service, cmd)
+
+	wait := service.wait.withDefaults()
+
+	// the command was refused, waiting will not change the service
+	var refused *CommandError
+	if errors.As(retErr, &refused) {
+		state, _ := serviceHandler.Status(service, protocol)
+		return state, actionFailed(service, protocol, serviceHandler, wantedStatus, state, retErr)
+	}
+
+	if wait.NoWait {
+		state, err := serviceHandler.Status(service, protocol)
+		if retErr == nil {
+			retErr = err
+		}
+		return state, retErr
+	}
+
+	if wantedStatus == ServiceStatusStopped && service.killAfter > 0 {
+		wait.Timeout = service.killAfter
+	}
+
+	poll := StatusPoll{Timeout: wait.Timeout, Interval: wait.Interval, Backoff: wait.Backoff, Jitter: wait.Jitter, Progress: printProgress}
+
+	state, checks, retErr := pollStatus(service, protocol, serviceHandler, wantedStatus, poll, retErr)
+
+	// a graceful stop timed out, kill the service's processes
+	if !state.Is(wantedStatus) && retErr == nil && wantedStatus == ServiceStatusStopped && (service.force || service.killAfter > 0) {
+
+		fmt.Fprintln(console, fmt.Sprintf("service %s did not stop after %d status checks, killing it", service.name, checks))
+
+		if retErr = serviceHandler.Kill(service, protocol, state.PID); retErr == nil {
+			poll.Timeout = 0
+			poll.Attempts = KillStatusChecks
+			state, checks, retErr = pollStatus(service, protocol, serviceHandler, wantedStatus, poll, nil)
+		}
+	}
+
+	if !state.Is(wantedStatus) {
+
+		if retErr == nil && state.Is(ServiceStatusNotFound) {
+			retErr = fmt.Errorf("%w: %s", ErrServiceNotFound, service.name)
+		} else if retErr == nil {
+			retErr = fmt.Errorf("%w after %d status checks", ErrTimeout, checks)
+		}
+
+		return state, actionFailed(service, protocol, serviceHandler, wantedStatus, state, retErr)
+	}
+
+	return state, retErr
+}
+
+// statusFromList finds the status of every name in the handler's list of services. The names whose state
+// the list does not tell are asked for one by one, so are the names it misses unless it lists every service
+func statusFromList(handler ServiceHandler, service Service, names []string, protocol ProtocolHandler, listsAll bool) ([]ServiceState, error) {
+	log.Info("determining status of %d services", len(names))
+
+	entries, err := handler.List(service, protocol)
+
+	if err != nil {
+		return []ServiceState{}, err
+	}
+
+	found := map[string]ServiceState{}
+	for _, entry := range entries {
+		found[strings.ToLower(entry.Name)] = entry.State
+	}
+
+	states := []ServiceState{}
+	for _, name := range names {
+
+		state, ok := found[strings.ToLower(name)]
+
+		if !ok && listsAll {
+			state = ServiceState{Status: ServiceStatusNotFound}
+		}
+
+		if (!ok && !listsAll) || state.Is(ServiceStatusUnknown) {
+
+			named := service
+			named.name = name
+
+			state, err = handler.Status(named, protocol)
+
+			if errors.Is(err, ErrServiceNotFound) {
+				state, err = ServiceState{Status: ServiceStatusNotFound}, nil
+			}
+
+			if err != nil {
+				return states, err
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// statusEach asks for the status of the services one after the other
+func statusEach(handler ServiceHandler, service Service, names []string, protocol ProtocolHandler) ([]ServiceState, error) {
+
+	states := []ServiceState{}
+
+	for _, name := range names {
+
+		named := service
+		named.name = name
+
+		state, err := handler.Status(named, protocol)
+		if err != nil {
+			return states, err
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// StopThenStart restarts a service without a native restart command, a stopped service is just started
+func StopThenStart(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler) (ServiceState, error) {
+
+	state, err := serviceHandler.Status(service, protocol)
+
+	if err == nil && state.Is(ServiceStatusNotFound) {
+		return state, fmt.Errorf("%w: %s", ErrServiceNotFound, service.name)
+	}
+
+	if err == nil && !state.Is(ServiceStatusStopped) {
+		state, err = serviceHandler.Stop(service, protocol)
+	}
+
+	if err == nil {
+		state, err = serviceHandler.Start(service, protocol)
+	}
+
+	return state, err
+}
+
+// pollStatus checks the status until it is wantedStatus, the status fails or the poll's attempts or timeout run out
+func pollStatus(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, wantedStatus int, poll StatusPoll, retErr error) (ServiceState, int, error) {
+
+	var err error
+	var state ServiceState
+
+	delay := poll.Interval
+	waited := time.Duration(0)
+	deadline := time.Now().Add(poll.Timeout)
+
+	i := 0
+	for {
+
+		state, err = serviceHandler.Status(service, protocol)
+
+		// set retErr to error from status only if it's never been set
+		// or call to Status returned no error
+		if retErr == nil || err == nil {
+			retErr = err
+		}
+
+		// waiting will not make a service that does not exist reach the status
+		if retErr != nil || state.Is(wantedStatus) || state.Is(ServiceStatusNotFound) {
+			break
+		}
+
+		// the time slept between the checks is what the timeout limits, slow status checks are cut off at the deadline
+		if poll.Timeout > 0 && (waited+delay > poll.Timeout || time.Now().After(deadline)) {
+			break
+		}
+
+		if poll.Timeout <= 0 && i >= poll.Attempts {
+			break
+		}
+
+		if poll.Progress != nil {
+			poll.Progress(state)
+		}
+
+		time.Sleep(poll.jitter(delay))
+		waited += delay
+		delay = poll.next(delay)
+		i++
+	}
+
+	return state, i, retErr
+}
+
+// next returns the delay before the recheck following one that waited delay
+func (p StatusPoll) next(delay time.Duration) time.Duration {
+
+	if p.Backoff <= 1 {
+		return delay
+	}
+
+	next := time.Duration(float64(delay) * p.Backoff)
+	if next > MaxPollInterval {
+		next = MaxPollInterval
+	}
+
+	if next < delay {
+		return delay
+	}
+
+	return next
+}
+
+func (p StatusPoll) jitter(delay time.Duration) time.Duration {
+
+	if p.Jitter <= 0 {
+		return delay
+	}
+
+	return time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+func printProgress(state ServiceState) {
+	fmt.Fprint(console, ".")
+}
+
+// WaitFor polls the status until the service reaches wantedStatus or the --timeout passes, printing every change of its status
+func WaitFor(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, wantedStatus int) (ServiceState, error) {
+
+	last := -1
+	wait := service.wait.withDefaults()
+
+	poll := StatusPoll{
+		Timeout:  service.timeout,
+		Interval: wait.Interval,
+		Backoff:  wait.Backoff,
+		Jitter:   wait.Jitter,
+		Progress: func(state ServiceState) {
+			if state.Status != last {
+				fmt.Fprintln(console, fmt.Sprintf("%s service %s is %s", time.Now().Format("15:04:05"), service.name, ServiceStatus[state.Status]))
+				last = state.Status
+			}
+		},
+	}
+
+	start := time.Now()
+	state, checks, err := pollStatus(service, protocol, serviceHandler, wantedStatus, poll, nil)
+
+	if err == nil && state.Is(ServiceStatusNotFound) {
+		err = fmt.Errorf("%w: %s", ErrServiceNotFound, service.name)
+	} else if err == nil && !state.Is(wantedStatus) {
+		err = fmt.Errorf("service %s is %s, expected %s: %w after %s (%d status checks)",
+			service.name, ServiceStatus[state.Status], ServiceStatus[wantedStatus], ErrTimeout, time.Since(start).Round(time.Second), checks+1)
+	}
+
+	return state, err
+}
+
+// ActionFailedError is returned when a service did not reach the wanted status,
+// it carries the handler's last status output and the most recent log lines
+type ActionFailedError struct {
+	Service string
+	Wanted  int
+	State   ServiceState
+	Cause   error
+	Logs    string
+}
+
+func (e *ActionFailedError) Error() string {
+
+	str := fmt.Sprintf("service %s is %s, expected %s", e.Service, ServiceStatus[e.State.Status], ServiceStatus[e.Wanted])
+
+	if e.Cause != nil {
+		str = fmt.Sprintf("%s: %s", str, e.Cause.Error())
+	}
+
+	if output := strings.TrimSpace(e.State.Output); output != "" {
+		str = fmt.Sprintf("%s\n--- status ---\n%s", str, output)
+	}
+
+	if logs := strings.TrimSpace(e.Logs); logs != "" {
+		str = fmt.Sprintf("%s\n--- logs ---\n%s", str, logs)
+	}
+
+	return str
+}
+
+// Is reports a service that does not exist as ErrServiceNotFound, whatever the cause
+func (e *ActionFailedError) Is(target error) bool {
+	return target == ErrServiceNotFound && e.State.Is(ServiceStatusNotFound)
+}
+
+func (e *ActionFailedError) Unwrap() error {
+	return e.Cause
+}
+
+// actionFailed collects the recent logs of the service to explain why it did not reach the wanted status
+func actionFailed(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, wantedStatus int, state ServiceState, cause error) error {
+
+	var logs bytes.Buffer
+
+	logService := service
+	logService.follow = false
+	logService.since = 0
+
+	if logService.lines <= 0 {
+		logService.lines = DiagnosticLogLines
+	}
+
+	if err := serviceHandler.Logs(logService, protocol, &logs); err != nil {
+		log.Debug("unable to fetch logs of %s: %s", service.name, err.Error())
+	}
+
+	return &ActionFailedError{
+		Service: service.name,
+		Wanted:  wantedStatus,
+		State:   state,
+		Cause:   cause,
+		Logs:    logs.String(),
+	}
+}
+
+// EnableOrDisable changes the service's start type using cmd, then starts or stops it when --now was given
+func EnableOrDisable(service Service, protocol ProtocolHandler, serviceHandler ServiceHandler, cmd string, startType string) (ServiceState, error) {
+
+	_, err := protocol.Run(service, cmd)
+
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	// the shell does not report a command that failed, the start type the host reports tells whether it worked
+	actual, err := serviceHandler.StartType(service, protocol)
+
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	if actual != startType {
+		return ServiceState{Status: ServiceStatusUnknown, StartType: actual},
+			fmt.Errorf("start type of %s is %s after %s, expected %s", service.name, actual, service.action, startType)
+	}
+
+	var state ServiceState
+
+	if service.now && startType == "disabled" {
+		state, err = serviceHandler.Stop(service, protocol)
+	} else if service.now {
+		state, err = serviceHandler.Start(service, protocol)
+	} else {
+		state, err = serviceHandler.Status(service, protocol)
+	}
+
+	state.StartType = actual
+
+	return state, err
+}
+
+// uploadDefinition copies the local file to a temporary file on the host, then installs it at path with mode
+func uploadDefinition(service Service, protocol ProtocolHandler, file string, path string, mode string) error {
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	// mktemp creates a file with a random name only the user can write, so nobody can put their own file in its place
+	stdout, err := protocol.Run(service, fmt.Sprintf("mktemp /tmp/sms-%s.XXXXXXXXXX", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+
+	// the path is on a line of its own, the ssh shell prints its prompt after it
+	m := regexp.MustCompile(`(?m)^(/tmp/sms-[^\s'"]+)\s*$`).FindStringSubmatch(stdout)
+	if m == nil {
+		return fmt.Errorf("creating a temporary file for %s failed: %s", path, strings.TrimSpace(stdout))
+	}
+
+	tmp := m[1]
+
+	if err = protocol.Upload(service, tmp, content); err != nil {
+		protocol.Run(service, fmt.Sprintf("rm -f %s", tmp))
+		return err
+	}
+
+	cmd := addSudo(fmt.Sprintf("install -m %s %s %s", mode, tmp, path), service)
+	stdout, err = protocol.Run(service, cmd)
+
+	if err == nil && !checkCommandSupported(stdout, "") {
+		err = fmt.Errorf("installing %s failed: %s", path, strings.TrimSpace(stdout))
+	}
+
+	protocol.Run(service, fmt.Sprintf("rm -f %s", tmp))
+
+	return err
+}
+
+func notSupported(action string, serviceHandler ServiceHandler) error {
+	return fmt.Errorf("%s is not supported by %s", action, reflect.TypeOf(serviceHandler).Elem().Name())
+}
+
+// Search filters the handler's entries by the service's name, using the --glob, --regex or --exact
+// match mode or else a plain substring, and by the --state filter
+func Search(service Service, entries []ServiceEntry, err error) ([]ServiceEntry, error) {
+
+	list := []ServiceEntry{}
+
+	if err != nil {
+		return list, err
+	}
+
+	match, err := nameMatcher(service)
+
+	if err != nil {
+		return list, err
+	}
+
+	for _, entry := range entries {
+
+		if !match(entry.Name) && !match(entry.DisplayName) {
+			continue
+		}
+
+		if service.stateFilter != "" && !entry.State.Is(statusByName(service.stateFilter)) {
+			continue
+		}
+
+		list = append(list, entry)
+	}
+
+	return list, nil
+}
+
+// nameMatcher matches names ignoring case, as Windows does for its service names
+func nameMatcher(service Service) (func(string) bool, error) {
+
+	pattern := strings.ToLower(service.name)
+
+	switch service.match {
+	case "glob":
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %s", service.name, err.Error())
+		}
+		return func(name string) bool {
+			matched, _ := filepath.Match(pattern, strings.ToLower(name))
+			return matched
+		}, nil
+
+	case "regex":
+		rp, err := regexp.Compile("(?i)" + service.name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %s: %s", service.name, err.Error())
+		}
+		return func(name string) bool { return rp.MatchString(name) }, nil
+
+	case "exact":
+		return func(name string) bool { return strings.EqualFold(name, service.name) }, nil
+	}
+
+	return func(name string) bool { return name != "" && strings.Contains(strings.ToLower(name), pattern) }, nil
+}
+
+// statusByName returns the status named name or ServiceStatusUnknown
+func statusByName(name string) int {
+
+	for i, s := range ServiceStatus {
+		if s == name {
+			return i
+		}
+	}
 
+	return ServiceStatusUnknown
 }
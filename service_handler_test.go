@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Service is running with the pid 7112
 func TestServiceExecServiceHandlerStatus01(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{"Service is running with the pid 7112"}}
+	mock := MockProtocolHandler{results: [20]string{"Service is running with the pid 7112"}}
 
 	handler := ProtocolHandler(&mock)
 
@@ -24,7 +32,7 @@ func TestServiceExecServiceHandlerStatus01(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -41,7 +49,7 @@ func TestServiceExecServiceHandlerStatus01(t *testing.T) {
 func TestServiceExecServiceHandlerStatus02(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{"service is running (17687)"}}
+	mock := MockProtocolHandler{results: [20]string{"service is running (17687)"}}
 
 	handler := ProtocolHandler(&mock)
 
@@ -58,7 +66,7 @@ func TestServiceExecServiceHandlerStatus02(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -75,7 +83,7 @@ func TestServiceExecServiceHandlerStatus02(t *testing.T) {
 func TestServiceExecServiceHandlerStatus03(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{""}}
+	mock := MockProtocolHandler{results: [20]string{""}}
 
 	handler := ProtocolHandler(&mock)
 
@@ -91,7 +99,7 @@ func TestServiceExecServiceHandlerStatus03(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusUnknown {
+	if result.Status != ServiceStatusUnknown {
 		t.Error("Expected service unknown, got ", result)
 	}
 
@@ -108,7 +116,7 @@ func TestServiceExecServiceHandlerStatus03(t *testing.T) {
 func TestServiceExecServiceHandlerStart01(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{"Started service with pid 7112", "Service is running with the pid 7112"}}
+	mock := MockProtocolHandler{results: [20]string{"Started service with pid 7112", "Service is running with the pid 7112"}}
 
 	handler := ProtocolHandler(&mock)
 
@@ -124,7 +132,7 @@ func TestServiceExecServiceHandlerStart01(t *testing.T) {
 	result, _ := r.Start(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -145,7 +153,7 @@ func TestServiceExecServiceHandlerStart01(t *testing.T) {
 func TestServiceExecServiceHandlerStop01(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{"Stopped service", "Service is stopped"}}
+	mock := MockProtocolHandler{results: [20]string{"Stopped service", "Service is stopped"}}
 
 	handler := ProtocolHandler(&mock)
 
@@ -161,7 +169,7 @@ func TestServiceExecServiceHandlerStop01(t *testing.T) {
 	result, _ := r.Stop(service, handler)
 
 	// then
-	if result != ServiceStatusStopped {
+	if result.Status != ServiceStatusStopped {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -178,14 +186,59 @@ func TestServiceExecServiceHandlerStop01(t *testing.T) {
 	}
 }
 
+// List the services of a Red Hat host
+func TestServiceExecServiceHandlerList01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`auditd (pid  1021) is running...
+crond (pid  1388) is running...
+iptables: Firewall is not running.
+netconsole module not loaded
+Configured devices:
+lo eth0
+Currently active devices:
+lo eth0
+postfix is stopped
+rsyslogd dead but pid file exists
+sshd (pid  1262) is running...`}}
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{host: "myhost", action: "list"}
+
+	// when
+	result, err := r.List(service, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	expected := map[string]int{"auditd": ServiceStatusStarted, "crond": ServiceStatusStarted, "iptables": ServiceStatusStopped,
+		"postfix": ServiceStatusStopped, "rsyslogd": ServiceStatusFailed, "sshd": ServiceStatusStarted}
+
+	if len(result) != len(expected) {
+		t.Error("Expected ", len(expected), " services, got ", result)
+	}
+
+	for _, entry := range result {
+		if status, ok := expected[entry.Name]; !ok || entry.State.Status != status {
+			t.Error("Expected other state of ", entry.Name, ", got ", entry.State)
+		}
+	}
+
+	if len(result) > 0 && (result[0].Name != "auditd" || result[0].State.PID != 1021) {
+		t.Error("Expected auditd with pid 1021, got ", result[0])
+	}
+}
+
 // Search Service
 func TestServiceExecServiceHandlerSearch01(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{` [ ? ]  service1
- [ ? ]  myname
+	mock := MockProtocolHandler{results: [20]string{` [ ? ]  service1
+ [ + ]  myname
  [ ? ]  service2
- [ ? ]  myname2
+ [ - ]  myname2
  [ ? ]  testmyname`}}
 
 	handler := ProtocolHandler(&mock)
@@ -206,16 +259,16 @@ func TestServiceExecServiceHandlerSearch01(t *testing.T) {
 		t.Error("Expected 3 result, got ", len(result))
 	}
 
-	if len(result) == 3 && result[0] != "[ ? ]  myname" {
-		t.Error("Expected [ ? ]  myname result, got ", result[0])
+	if len(result) == 3 && (result[0].Name != "myname" || result[0].State.Status != ServiceStatusStarted) {
+		t.Error("Expected myname started result, got ", result[0])
 	}
 
-	if len(result) == 3 && result[1] != "[ ? ]  myname2" {
-		t.Error("Expected [ ? ]  myname2 result, got ", result[1])
+	if len(result) == 3 && (result[1].Name != "myname2" || result[1].State.Status != ServiceStatusStopped) {
+		t.Error("Expected myname2 stopped result, got ", result[1])
 	}
 
-	if len(result) == 3 && result[2] != "[ ? ]  testmyname" {
-		t.Error("Expected [ ? ]  testmyname result, got ", result[2])
+	if len(result) == 3 && (result[2].Name != "testmyname" || result[2].State.Status != ServiceStatusUnknown) {
+		t.Error("Expected testmyname unknown result, got ", result[2])
 	}
 
 	if mock.run != 1 {
@@ -228,9 +281,11 @@ func TestServiceExecServiceHandlerSearch01(t *testing.T) {
 }
 
 type MockProtocolHandler struct {
-	runs    [10]string
-	results [10]string
+	runs    [20]string
+	results [20]string
+	errors  [20]error
 	run     int
+	uploads []string
 }
 
 func (r *MockProtocolHandler) OpenConnection(service Service) error {
@@ -244,18 +299,48 @@ func (r *MockProtocolHandler) Run(service Service, cmd string) (string, error) {
 
 	r.runs[r.run] = cmd
 	s := r.results[r.run]
+	err := r.errors[r.run]
 
 	r.run += 1
 
 	log.Info("mock got response ", s)
 
-	return s, nil
+	return s, err
+}
+
+func (r *MockProtocolHandler) Stream(service Service, cmd string, out io.Writer) error {
+
+	s, err := r.Run(service, cmd)
+	fmt.Fprint(out, s)
+
+	return err
+}
+
+func (r *MockProtocolHandler) Upload(service Service, path string, content []byte) error {
+
+	r.uploads = append(r.uploads, fmt.Sprintf("%s:%s", path, content))
+
+	return nil
 }
 
 func (r *MockProtocolHandler) CloseConnection(service Service) {
 	log.Info("mock close connection")
 }
 
+// MockExitCodeProtocolHandler also reports the exit codes of its commands
+type MockExitCodeProtocolHandler struct {
+	MockProtocolHandler
+	codes [20]int
+}
+
+func (r *MockExitCodeProtocolHandler) RunExitCode(service Service, cmd string) (string, int, error) {
+
+	code := r.codes[r.run]
+	stdout, err := r.Run(service, cmd)
+
+	return stdout, code, err
+}
+
 func (r *MockProtocolHandler) IsSupported(service Service) bool {
 	return true
 }
@@ -267,7 +352,7 @@ func (r *MockProtocolHandler) IsPasswordNeeded(service Service) bool {
 // Service is running
 func TestLinuxToWindowsStatus01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`myname service is running.
 Configuration details:
         Controls Accepted    = 0x45
@@ -296,7 +381,7 @@ Configuration details:
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -312,7 +397,7 @@ Configuration details:
 // Service is stopped
 func TestLinuxToWindowsStatus02(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`myname service is stopped.
 Configuration details:
         Controls Accepted    = 0x0
@@ -342,7 +427,7 @@ Configuration details:
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStopped {
+	if result.Status != ServiceStatusStopped {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -355,10 +440,10 @@ Configuration details:
 	}
 }
 
-// Service is unknown
+// Service does not exist
 func TestLinuxToWindowsStatus03(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`Failed to open service.  [WERR_NO_SUCH_SERVICE]`,
 	}}
 
@@ -376,8 +461,8 @@ func TestLinuxToWindowsStatus03(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusUnknown {
-		t.Error("Expected service started, got ", result)
+	if result.Status != ServiceStatusNotFound {
+		t.Error("Expected service not found, got ", result)
 	}
 
 	if mock.run != 1 {
@@ -392,7 +477,7 @@ func TestLinuxToWindowsStatus03(t *testing.T) {
 // Start Service
 func TestLinuxToWindowsStart01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{"",
+	mock := MockProtocolHandler{results: [20]string{"",
 		`myname service is running.
 Configuration details:
         Controls Accepted    = 0x45
@@ -421,7 +506,7 @@ Configuration details:
 	result, _ := r.Start(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -441,7 +526,7 @@ Configuration details:
 // Stop Service
 func TestLinuxToWindowsStop01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{"",
+	mock := MockProtocolHandler{results: [20]string{"",
 		`myname service is stopped.
 Configuration details:
         Controls Accepted    = 0x0
@@ -471,7 +556,7 @@ Configuration details:
 	result, _ := r.Stop(service, handler)
 
 	// then
-	if result != ServiceStatusStopped {
+	if result.Status != ServiceStatusStopped {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -492,7 +577,7 @@ Configuration details:
 func TestLinuxToWindowsSearch01(t *testing.T) {
 
 	// given
-	mock := MockProtocolHandler{results: [10]string{`service1		"Application service1"
+	mock := MockProtocolHandler{results: [20]string{`service1		"Application service1"
  myname			"Application myname"
  service2		"Application service2"
  myname2		"Application myname2"
@@ -500,7 +585,7 @@ func TestLinuxToWindowsSearch01(t *testing.T) {
 
 	handler := ProtocolHandler(&mock)
 
-	r := ServiceHandler(&ServiceExecServiceHandler{})
+	r := ServiceHandler(&SambaServiceHandler{})
 	service := Service{
 		user:     "myuser",
 		password: "mypass",
@@ -516,23 +601,23 @@ func TestLinuxToWindowsSearch01(t *testing.T) {
 		t.Error("Expected 3 result, got ", len(result))
 	}
 
-	if len(result) == 3 && result[0] != "myname			\"Application myname\"" {
-		t.Error("Expected myname			\"Application myname\" result, got ", result[0])
+	if len(result) == 3 && (result[0].Name != "myname" || result[0].DisplayName != "Application myname") {
+		t.Error("Expected myname \"Application myname\" result, got ", result[0])
 	}
 
-	if len(result) == 3 && result[1] != "myname2		\"Application myname2\"" {
-		t.Error("Expected myname2		\"Application myname2\" result, got ", result[1])
+	if len(result) == 3 && (result[1].Name != "myname2" || result[1].DisplayName != "Application myname2") {
+		t.Error("Expected myname2 \"Application myname2\" result, got ", result[1])
 	}
 
-	if len(result) == 3 && result[2] != "testmyname		\"Application testmyname\"" {
-		t.Error("Expected testmyname		\"Application testmyname\" result, got ", result[2])
+	if len(result) == 3 && (result[2].Name != "testmyname" || result[2].DisplayName != "Application testmyname") {
+		t.Error("Expected testmyname \"Application testmyname\" result, got ", result[2])
 	}
 
 	if mock.run != 1 {
 		t.Error("Expected runs of 1, got ", mock.run)
 	}
 
-	if mock.runs[0] != "service --status-all" {
+	if mock.runs[0] != "net rpc service list -I myhost -U myuser%mypass" {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 }
@@ -540,7 +625,7 @@ func TestLinuxToWindowsSearch01(t *testing.T) {
 // Service is running
 func TestWindowsToWindowsStatus01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`SERVICE_NAME: myname
 	       TYPE               : 10
 	       WIN32_OWN_PROCESS
@@ -566,7 +651,7 @@ func TestWindowsToWindowsStatus01(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -574,7 +659,7 @@ func TestWindowsToWindowsStatus01(t *testing.T) {
 		t.Error("Expected runs of 1, got ", mock.run)
 	}
 
-	if mock.runs[0] != "sc \\\\myhost query myname" {
+	if mock.runs[0] != "sc \\\\myhost queryex myname" {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 }
@@ -582,7 +667,7 @@ func TestWindowsToWindowsStatus01(t *testing.T) {
 // Service is stopped
 func TestWindowsToWindowsStatus02(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`SERVICE_NAME: myname
         TYPE               : 10  WIN32_OWN_PROCESS
         STATE              : 1  STOPPED
@@ -606,7 +691,7 @@ func TestWindowsToWindowsStatus02(t *testing.T) {
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusStopped {
+	if result.Status != ServiceStatusStopped {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -614,15 +699,15 @@ func TestWindowsToWindowsStatus02(t *testing.T) {
 		t.Error("Expected runs of 1, got ", mock.run)
 	}
 
-	if mock.runs[0] != "sc \\\\myhost query myname" {
+	if mock.runs[0] != "sc \\\\myhost queryex myname" {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 }
 
-// Service is unknown
+// Service does not exist
 func TestWindowsToWindowsStatus03(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{
+	mock := MockProtocolHandler{results: [20]string{
 		`[SC] EnumQueryServicesStatus:OpenService FAILED 1060:
 
 The specified service does not exist as an installed service.`,
@@ -642,15 +727,15 @@ The specified service does not exist as an installed service.`,
 	result, _ := r.Status(service, handler)
 
 	// then
-	if result != ServiceStatusUnknown {
-		t.Error("Expected service started, got ", result)
+	if result.Status != ServiceStatusNotFound {
+		t.Error("Expected service not found, got ", result)
 	}
 
 	if mock.run != 1 {
 		t.Error("Expected runs of 1, got ", mock.run)
 	}
 
-	if mock.runs[0] != "sc \\\\myhost query myname" {
+	if mock.runs[0] != "sc \\\\myhost queryex myname" {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 }
@@ -658,7 +743,7 @@ The specified service does not exist as an installed service.`,
 // Start Service
 func TestWindowsToWindowsStart01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{"",
+	mock := MockProtocolHandler{results: [20]string{"",
 		`SERVICE_NAME: myname
 	       TYPE               : 10
 	       WIN32_OWN_PROCESS
@@ -684,7 +769,7 @@ func TestWindowsToWindowsStart01(t *testing.T) {
 	result, _ := r.Start(service, handler)
 
 	// then
-	if result != ServiceStatusStarted {
+	if result.Status != ServiceStatusStarted {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -696,7 +781,7 @@ func TestWindowsToWindowsStart01(t *testing.T) {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 
-	if mock.runs[1] != "sc \\\\myhost query myname" {
+	if mock.runs[1] != "sc \\\\myhost queryex myname" {
 		t.Error("Expected other, got ", mock.runs[1])
 	}
 }
@@ -704,7 +789,7 @@ func TestWindowsToWindowsStart01(t *testing.T) {
 // Stop Service
 func TestWindowsToWindowsStop01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{"",
+	mock := MockProtocolHandler{results: [20]string{"",
 		`SERVICE_NAME: myname
         TYPE               : 10  WIN32_OWN_PROCESS
         STATE              : 1  STOPPED
@@ -728,7 +813,7 @@ func TestWindowsToWindowsStop01(t *testing.T) {
 	result, _ := r.Stop(service, handler)
 
 	// then
-	if result != ServiceStatusStopped {
+	if result.Status != ServiceStatusStopped {
 		t.Error("Expected service started, got ", result)
 	}
 
@@ -740,7 +825,7 @@ func TestWindowsToWindowsStop01(t *testing.T) {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
 
-	if mock.runs[1] != "sc \\\\myhost query myname" {
+	if mock.runs[1] != "sc \\\\myhost queryex myname" {
 		t.Error("Expected other, got ", mock.runs[1])
 	}
 }
@@ -748,9 +833,11 @@ func TestWindowsToWindowsStop01(t *testing.T) {
 // Search Service
 func TestWindowsToWindowsSearch01(t *testing.T) {
 	// given
-	mock := MockProtocolHandler{results: [10]string{`Name
-myname6032
-myname7047`,
+	mock := MockProtocolHandler{results: [20]string{`
+Node,DisplayName,Name,StartMode,State
+MYHOST,My Name 6032,myname6032,Auto,Running
+MYHOST,Other,other,Manual,Stopped
+MYHOST,My Name 7047,myname7047,Disabled,Stopped`,
 	}}
 
 	handler := ProtocolHandler(&mock)
@@ -771,20 +858,1753 @@ myname7047`,
 		t.Error("Expected 2 result, got ", len(result))
 	}
 
-	if len(result) == 2 && result[0] != "myname6032" {
-		t.Error("Expected myname6032 result, got ", result[1])
+	if len(result) == 2 && (result[0].Name != "myname6032" || result[0].DisplayName != "My Name 6032" || result[0].State.Status != ServiceStatusStarted || !result[0].State.IsEnabled()) {
+		t.Error("Expected myname6032 started and enabled result, got ", result[0])
+	}
+
+	if len(result) == 2 && (result[1].Name != "myname7047" || result[1].State.Status != ServiceStatusDisabled) {
+		t.Error("Expected myname7047 disabled result, got ", result[1])
+	}
+
+	if mock.run != 1 {
+		t.Error("Expected runs of 1, got ", mock.run)
+	}
+
+	if mock.runs[0] != "wmic /node:'myhost' service get Name,DisplayName,State,StartMode /format:csv" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+
+}
+
+// systemd output through the service command
+func TestServiceExecServiceHandlerStatus04(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`● myname.service - My Name Daemon
+   Loaded: loaded (/lib/systemd/system/myname.service; enabled; vendor preset: enabled)
+   Active: active (running) since Mon 2015-03-02 10:00:00 UTC; 2h 3min ago
+ Main PID: 1234 (myname)
+   CGroup: /system.slice/myname.service
+           └─1234 /usr/sbin/myname`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if result.SubState != "running" {
+		t.Error("Expected running, got ", result.SubState)
+	}
+
+	if result.PID != 1234 {
+		t.Error("Expected pid 1234, got ", result.PID)
+	}
+
+	if result.Uptime != 2*time.Hour+3*time.Minute {
+		t.Error("Expected uptime of 2h3m, got ", result.Uptime)
+	}
+
+	if result.StartType != "enabled" || !result.IsEnabled() {
+		t.Error("Expected enabled, got ", result.StartType)
+	}
+
+	if result.Description != "My Name Daemon" {
+		t.Error("Expected My Name Daemon, got ", result.Description)
+	}
+}
+
+// failed systemd service
+func TestServiceExecServiceHandlerStatus05(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`● myname.service - My Name Daemon
+   Loaded: loaded (/lib/systemd/system/myname.service; disabled; vendor preset: enabled)
+   Active: failed (Result: exit-code) since Mon 2015-03-02 10:00:00 UTC; 5s ago`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{name: "myname", action: "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusFailed {
+		t.Error("Expected service failed, got ", result)
+	}
+
+	if result.Uptime != 0 {
+		t.Error("Expected no uptime, got ", result.Uptime)
+	}
+
+	if result.IsEnabled() {
+		t.Error("Expected disabled, got ", result.StartType)
+	}
+}
+
+// Service is paused and disabled at boot
+func TestLinuxToWindowsStatus04(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`myname service is paused.
+Configuration details:
+        Controls Accepted    = 0x45
+        Service Type         = 0x10
+        Start Type           = 0x4
+        Display Name         = My Application`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SambaServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusPaused {
+		t.Error("Expected service paused, got ", result)
+	}
+
+	if result.StartType != "disabled" {
+		t.Error("Expected disabled, got ", result.StartType)
+	}
+
+	if result.Description != "My Application" {
+		t.Error("Expected My Application, got ", result.Description)
+	}
+}
+
+// Service is starting
+func TestWindowsToWindowsStatus04(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 2  START_PENDING
+                                (NOT_STOPPABLE, NOT_PAUSABLE, IGNORES_SHUTDOWN)
+        WIN32_EXIT_CODE    : 0  (0x0)
+        SERVICE_EXIT_CODE  : 0  (0x0)
+        CHECKPOINT         : 0x1
+        WAIT_HINT          : 0x7d0
+        PID                : 4242
+        FLAGS              :`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarting {
+		t.Error("Expected service starting, got ", result)
 	}
 
-	if len(result) == 2 && result[1] != "myname7047" {
-		t.Error("Expected myname7047 result, got ", result[2])
+	if result.PID != 4242 {
+		t.Error("Expected pid 4242, got ", result.PID)
 	}
 
 	if mock.run != 1 {
 		t.Error("Expected runs of 1, got ", mock.run)
 	}
+}
+
+// Enable Service at boot using chkconfig
+func TestServiceExecServiceHandlerEnable01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"", "", "1\r\nmyuser@myhost:~$ ", "Service is stopped"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "enable"}
+
+	// when
+	result, _ := r.Enable(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", result)
+	}
+
+	if result.StartType != "enabled" {
+		t.Error("Expected enabled, got ", result.StartType)
+	}
+
+	if mock.run != 4 {
+		t.Error("Expected runs of 4, got ", mock.run)
+	}
+
+	if mock.runs[0] != "command -v update-rc.d" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+
+	if mock.runs[1] != "sudo chkconfig myname on" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+
+	if mock.runs[2] != "ls /etc/rc[2345].d/ /etc/rc.d/rc[2345].d/ 2>/dev/null | grep -c '^S[0-9]*myname$'" {
+		t.Error("Expected other, got ", mock.runs[2])
+	}
+}
+
+// Enable Service at boot using update-rc.d, both steps run with sudo
+func TestServiceExecServiceHandlerEnable02(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"/usr/sbin/update-rc.d", "", "2", "Service is stopped"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		sudo:   "mysudo",
+		action: "enable"}
+
+	// when
+	result, err := r.Enable(service, handler)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if result.StartType != "enabled" {
+		t.Error("Expected enabled, got ", result.StartType)
+	}
+
+	if mock.runs[1] != "echo 'mysudo' | sudo -S update-rc.d myname defaults && echo 'mysudo' | sudo -S update-rc.d myname enable" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// Enable Service at boot fails quietly, the start type stays disabled
+func TestServiceExecServiceHandlerEnable03(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"/usr/sbin/update-rc.d", "update-rc.d: error: Permission denied", "0"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "enable"}
+
+	// when
+	result, err := r.Enable(service, handler)
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "start type of myname is disabled after enable, expected enabled") {
+		t.Error("Expected the start type error, got ", err)
+	}
+
+	if result.StartType != "disabled" {
+		t.Error("Expected disabled, got ", result.StartType)
+	}
+}
+
+// Disable Service at boot using update-rc.d
+func TestServiceExecServiceHandlerDisable01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"/usr/sbin/update-rc.d", "", "0", "Service is stopped"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		action: "disable"}
+
+	// when
+	result, _ := r.Disable(service, handler)
+
+	// then
+	if result.StartType != "disabled" {
+		t.Error("Expected disabled, got ", result.StartType)
+	}
+
+	if mock.runs[1] != "sudo update-rc.d myname disable" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// systemd unit is running
+func TestSystemctlServiceHandlerStatus01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`3725.50 7012.33
+LoadState=loaded
+ActiveState=active
+SubState=running
+MainPID=1234
+UnitFileState=enabled
+Description=My Name Daemon
+ActiveEnterTimestampMonotonic=125500000`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		action: "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if result.PID != 1234 || result.SubState != "running" || result.StartType != "enabled" || result.Description != "My Name Daemon" {
+		t.Error("Expected details, got ", result)
+	}
+
+	if result.Uptime != time.Hour {
+		t.Error("Expected uptime of 1h, got ", result.Uptime)
+	}
 
-	if mock.runs[0] != "wmic /node:'myhost' service where (name like '%myname%') get name" {
+	if mock.runs[0] != "cat /proc/uptime; systemctl show myname --no-pager -p LoadState,ActiveState,SubState,MainPID,UnitFileState,Description,ActiveEnterTimestampMonotonic" {
 		t.Error("Expected other, got ", mock.runs[0])
 	}
+}
 
+// systemd unit does not exist
+func TestSystemctlServiceHandlerStatus02(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`LoadState=not-found
+ActiveState=inactive
+SubState=dead
+MainPID=0
+UnitFileState=
+Description=myname.service`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", action: "status"}
+
+	// when
+	result, _ := r.Status(service, handler)
+
+	// then
+	if result.Status != ServiceStatusNotFound {
+		t.Error("Expected service not found, got ", result)
+	}
+}
+
+// Enable and start systemd unit
+func TestSystemctlServiceHandlerEnable01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"", `ActiveState=active
+UnitFileState=enabled`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		sudo:   "mysudo",
+		now:    true,
+		action: "enable"}
+
+	// when
+	result, _ := r.Enable(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted || !result.IsEnabled() {
+		t.Error("Expected service started and enabled, got ", result)
+	}
+
+	if mock.runs[0] != "echo 'mysudo' | sudo -S systemctl enable --now myname" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Enable Service at boot and start it
+func TestWindowsToWindowsEnable01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"[SC] ChangeServiceConfig SUCCESS",
+		`SERVICE_NAME: myname
+        START_TYPE         : 2   AUTO_START`, "",
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 4  RUNNING`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		now:      true,
+		action:   "enable"}
+
+	// when
+	result, _ := r.Enable(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if result.StartType != "auto" {
+		t.Error("Expected auto, got ", result.StartType)
+	}
+
+	if mock.runs[0] != "sc \\\\myhost config myname start= auto" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+
+	if mock.runs[1] != "sc \\\\myhost qc myname" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+
+	if mock.runs[2] != "sc \\\\myhost start myname" {
+		t.Error("Expected other, got ", mock.runs[2])
+	}
+}
+
+// Start type of Service
+func TestWindowsToWindowsStartType01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`[SC] QueryServiceConfig SUCCESS
+
+SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        START_TYPE         : 2   AUTO_START  (DELAYED)
+        ERROR_CONTROL      : 1   NORMAL
+        BINARY_PATH_NAME   : C:\myname\myname.exe
+        DISPLAY_NAME       : My Name`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "status"}
+
+	// when
+	result, _ := r.StartType(service, handler)
+
+	// then
+	if result != "delayed-auto" {
+		t.Error("Expected delayed-auto, got ", result)
+	}
+
+	if mock.runs[0] != "sc \\\\myhost qc myname" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// enable is not supported from Linux
+func TestLinuxToWindowsEnable01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SambaServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "enable"}
+
+	// when
+	_, err := r.Enable(service, handler)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+
+	if mock.run != 0 {
+		t.Error("Expected runs of 0, got ", mock.run)
+	}
+}
+
+// Pause Service, waiting through PAUSE_PENDING
+func TestWindowsToWindowsPause01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"",
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 6  PAUSE_PENDING`,
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 7  PAUSED`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "pause"}
+
+	// when
+	result, _ := r.Pause(service, handler)
+
+	// then
+	if result.Status != ServiceStatusPaused {
+		t.Error("Expected service paused, got ", result)
+	}
+
+	if mock.run != 3 {
+		t.Error("Expected runs of 3, got ", mock.run)
+	}
+
+	if mock.runs[0] != "sc \\\\myhost pause myname" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Continue Service
+func TestWindowsToWindowsContinue01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"",
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 4  RUNNING`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "continue"}
+
+	// when
+	result, _ := r.Continue(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if mock.runs[0] != "sc \\\\myhost continue myname" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Continue Service from Linux
+func TestLinuxToWindowsContinue01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"",
+		`myname service is resume pending.`,
+		`myname service is running.`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SambaServiceHandler{})
+	service := Service{
+		user:     "myuser",
+		password: "mypass",
+		host:     "myhost",
+		name:     "myname",
+		action:   "continue"}
+
+	// when
+	result, _ := r.Continue(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if mock.run != 3 {
+		t.Error("Expected runs of 3, got ", mock.run)
+	}
+
+	if mock.runs[0] != "net rpc service resume myname -I myhost -U myuser%mypass" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Logs of a systemd unit
+func TestSystemctlServiceHandlerLogs01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"Oct 19 10:00:00 myhost myname[1234]: started"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		name:   "myname",
+		lines:  20,
+		since:  time.Hour,
+		follow: true,
+		action: "logs"}
+
+	var out bytes.Buffer
+
+	// when
+	err := r.Logs(service, handler, &out)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if out.String() != "Oct 19 10:00:00 myhost myname[1234]: started" {
+		t.Error("Expected log line, got ", out.String())
+	}
+
+	if mock.runs[0] != "sudo journalctl -u myname --no-pager -n 20 --since=-3600s -f" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Logs of a SysV service
+func TestServiceExecServiceHandlerLogs01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{name: "myname", lines: 50, action: "logs"}
+	custom := Service{name: "myname", lines: 10, logFile: "/opt/myname/logs/server.log", follow: true, action: "logs"}
+
+	// when
+	r.Logs(service, handler, io.Discard)
+	r.Logs(custom, handler, io.Discard)
+
+	// then
+	if mock.runs[0] != "sudo tail -n 50 /var/log/myname.log" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+
+	if mock.runs[1] != "sudo tail -n 10 -f /opt/myname/logs/server.log" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// Event log of a Windows Service
+func TestWindowsToWindowsLogs01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", lines: 5, since: time.Minute, action: "logs"}
+
+	// when
+	err := r.Logs(service, handler, io.Discard)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if mock.runs[0] != "wevtutil qe Application /q:*[System[Provider[@Name='myname']][TimeCreated[timediff(@SystemTime)<=60000]]] /c:5 /rd:true /f:text /r:myhost" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Start fails and the status and logs are attached to the error
+func TestSystemctlServiceHandlerStart01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{
+		results: [20]string{
+			"Job for myname.service failed because the control process exited with error code.",
+			"ActiveState=failed\nSubState=failed",
+			"Oct 19 10:00:00 myhost myname[1234]: cannot bind to port 80"},
+		errors: [20]error{
+			errors.New("exit status 1"),
+			errors.New("connection reset")}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		action: "start"}
+
+	// when
+	result, err := r.Start(service, handler)
+
+	// then
+	if result.Status != ServiceStatusFailed {
+		t.Error("Expected service failed, got ", result)
+	}
+
+	failed, ok := err.(*ActionFailedError)
+	if !ok {
+		t.Fatal("Expected ActionFailedError, got ", err)
+	}
+
+	if failed.Cause.Error() != "exit status 1" {
+		t.Error("Expected exit status 1, got ", failed.Cause)
+	}
+
+	if !strings.Contains(err.Error(), "SubState=failed") || !strings.Contains(err.Error(), "cannot bind to port 80") {
+		t.Error("Expected status and logs in error, got ", err.Error())
+	}
+
+	if mock.runs[2] != "sudo journalctl -u myname --no-pager -n 20" {
+		t.Error("Expected other, got ", mock.runs[2])
+	}
+}
+
+// Dependencies of a systemd unit
+func TestSystemctlServiceHandlerDependencies01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`myname.service
+  network-online.target
+  postgresql.service
+  system.slice`, `myname.service
+  myapp.service
+    myweb.service
+  multi-user.target`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", action: "deps"}
+
+	// when
+	result, _ := r.Dependencies(service, handler)
+
+	// then
+	if len(result.Dependencies) != 1 || result.Dependencies[0] != "postgresql" {
+		t.Error("Expected postgresql, got ", result.Dependencies)
+	}
+
+	if len(result.Dependents) != 2 || result.Dependents[0] != "myweb" || result.Dependents[1] != "myapp" {
+		t.Error("Expected myweb then myapp, got ", result.Dependents)
+	}
+
+	if mock.runs[1] != "systemctl list-dependencies myname --reverse --plain --no-pager" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// Dependencies of a Windows Service
+func TestWindowsToWindowsDependencies01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{`[SC] QueryServiceConfig SUCCESS
+
+SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        START_TYPE         : 2   AUTO_START
+        BINARY_PATH_NAME   : C:\myname\myname.exe
+        DEPENDENCIES       : RPCSS
+                           : Tcpip
+        SERVICE_START_NAME : LocalSystem`, `Enum: entriesRead  = 1
+
+SERVICE_NAME: myapp
+DISPLAY_NAME: My App
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 4  RUNNING`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "deps"}
+
+	// when
+	result, _ := r.Dependencies(service, handler)
+
+	// then
+	if len(result.Dependencies) != 2 || result.Dependencies[0] != "RPCSS" || result.Dependencies[1] != "Tcpip" {
+		t.Error("Expected RPCSS and Tcpip, got ", result.Dependencies)
+	}
+
+	if len(result.Dependents) != 1 || result.Dependents[0] != "myapp" {
+		t.Error("Expected myapp, got ", result.Dependents)
+	}
+
+	if mock.runs[1] != "sc \\\\myhost enumdepend myname" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// Configuration of a systemd unit
+func TestSystemctlServiceHandlerConfig01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`ExecStart={ path=/usr/sbin/nginx ; argv[]=/usr/sbin/nginx -g daemon on; master_process on; ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }
+User=www-data
+FragmentPath=/lib/systemd/system/nginx.service
+UnitFileState=enabled
+Description=A high performance web server`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "nginx", action: "config"}
+
+	// when
+	result, _ := r.Config(service, handler)
+
+	// then
+	if result.Binary != "/usr/sbin/nginx -g daemon on; master_process on;" {
+		t.Error("Expected nginx command line, got ", result.Binary)
+	}
+
+	if result.Account != "www-data" || result.Path != "/lib/systemd/system/nginx.service" || result.StartType != "enabled" {
+		t.Error("Expected other, got ", result)
+	}
+
+	if mock.runs[0] != "systemctl show nginx --no-pager -p ExecStart,User,FragmentPath,UnitFileState,Description" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Configuration of a SysV service
+func TestServiceExecServiceHandlerConfig01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{`# Short-Description: My Name Daemon
+DAEMON=/usr/sbin/mynamed
+DAEMON_USER="myname"`, "1"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{name: "myname", action: "config"}
+
+	// when
+	result, _ := r.Config(service, handler)
+
+	// then
+	if result.Binary != "/usr/sbin/mynamed" || result.Account != "myname" || result.DisplayName != "My Name Daemon" {
+		t.Error("Expected other, got ", result)
+	}
+
+	if result.Path != "/etc/init.d/myname" || result.StartType != "enabled" {
+		t.Error("Expected other, got ", result)
+	}
+}
+
+// Configuration of a Windows Service
+func TestWindowsToWindowsConfig01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{`[SC] QueryServiceConfig SUCCESS
+
+SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        START_TYPE         : 3   DEMAND_START
+        ERROR_CONTROL      : 1   NORMAL
+        BINARY_PATH_NAME   : "C:\Program Files\myname\myname.exe" -service
+        LOAD_ORDER_GROUP   :
+        TAG                : 0
+        DISPLAY_NAME       : My Name
+        DEPENDENCIES       :
+        SERVICE_START_NAME : NT AUTHORITY\LocalService`}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "config"}
+
+	// when
+	result, _ := r.Config(service, handler)
+
+	// then
+	if result.Binary != `"C:\Program Files\myname\myname.exe" -service` {
+		t.Error("Expected binary, got ", result.Binary)
+	}
+
+	if result.Account != `NT AUTHORITY\LocalService` || result.StartType != "demand" || result.DisplayName != "My Name" {
+		t.Error("Expected other, got ", result)
+	}
+}
+
+// Install a systemd unit and start it
+func TestSystemctlServiceHandlerInstall01(t *testing.T) {
+
+	// given
+	unit := filepath.Join(t.TempDir(), "myname.service")
+	os.WriteFile(unit, []byte("[Service]\nExecStart=/usr/bin/myname\n"), 0644)
+
+	mock := MockProtocolHandler{results: [20]string{"/tmp/sms-myname.service.x7Kq2LmP9z\r\nmyuser@myhost:~$ ", "", "", "", "", "ActiveState=active\nUnitFileState=enabled"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		name:       "myname",
+		now:        true,
+		definition: ServiceDefinition{UnitFile: unit},
+		action:     "install"}
+
+	// when
+	result, err := r.Install(service, handler)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if result.Status != ServiceStatusStarted || !result.IsEnabled() {
+		t.Error("Expected service started and enabled, got ", result)
+	}
+
+	if len(mock.uploads) != 1 || mock.uploads[0] != "/tmp/sms-myname.service.x7Kq2LmP9z:[Service]\nExecStart=/usr/bin/myname\n" {
+		t.Error("Expected unit file upload, got ", mock.uploads)
+	}
+
+	expected := []string{
+		"mktemp /tmp/sms-myname.service.XXXXXXXXXX",
+		"sudo install -m 644 /tmp/sms-myname.service.x7Kq2LmP9z /etc/systemd/system/myname.service",
+		"rm -f /tmp/sms-myname.service.x7Kq2LmP9z",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl enable --now myname",
+	}
+
+	for i, cmd := range expected {
+		if mock.runs[i] != cmd {
+			t.Error("Expected ", cmd, " got ", mock.runs[i])
+		}
+	}
+}
+
+// Install does not upload when no temporary file could be created
+func TestSystemctlServiceHandlerInstall03(t *testing.T) {
+
+	// given
+	unit := filepath.Join(t.TempDir(), "myname.service")
+	os.WriteFile(unit, []byte("[Service]\nExecStart=/usr/bin/myname\n"), 0644)
+
+	mock := MockProtocolHandler{results: [20]string{"mktemp: failed to create file via template: No space left on device"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", definition: ServiceDefinition{UnitFile: unit}, action: "install"}
+
+	// when
+	_, err := r.Install(service, handler)
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "creating a temporary file for /etc/systemd/system/myname.service failed") {
+		t.Error("Expected the temporary file error, got ", err)
+	}
+
+	if len(mock.uploads) != 0 || mock.run != 1 {
+		t.Error("Expected no upload, got ", mock.uploads, mock.runs)
+	}
+}
+
+// Install needs a unit file
+func TestSystemctlServiceHandlerInstall02(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", action: "install"}
+
+	// when
+	_, err := r.Install(service, handler)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+
+	if mock.run != 0 {
+		t.Error("Expected runs of 0, got ", mock.run)
+	}
+}
+
+// Install a Windows Service
+func TestWindowsToWindowsInstall01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"[SC] CreateService SUCCESS",
+		`SERVICE_NAME: myname
+        TYPE               : 10  WIN32_OWN_PROCESS
+        STATE              : 1  STOPPED`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{
+		host:   "myhost",
+		name:   "myname",
+		action: "install",
+		definition: ServiceDefinition{
+			BinPath:     `C:\Program Files\myname\myname.exe`,
+			DisplayName: "My Name",
+			StartType:   "demand"}}
+
+	// when
+	result, _ := r.Install(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", result)
+	}
+
+	if mock.runs[0] != `sc \\myhost create myname binPath= "C:\Program Files\myname\myname.exe" DisplayName= "My Name" start= demand` {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Uninstall a running Windows Service
+func TestWindowsToWindowsUninstall01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`SERVICE_NAME: myname
+        STATE              : 4  RUNNING`,
+		"",
+		`SERVICE_NAME: myname
+        STATE              : 1  STOPPED`,
+		"[SC] DeleteService SUCCESS",
+		`[SC] EnumQueryServicesStatus:OpenService FAILED 1060:`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "uninstall"}
+
+	// when
+	result, _ := r.Uninstall(service, handler)
+
+	// then
+	if result.Status != ServiceStatusNotFound {
+		t.Error("Expected service not found, got ", result)
+	}
+
+	if mock.runs[1] != "sc \\\\myhost stop myname" || mock.runs[3] != "sc \\\\myhost delete myname" {
+		t.Error("Expected stop and delete, got ", mock.runs)
+	}
+}
+
+// Stop times out and the unit is killed
+func TestSystemctlServiceHandlerStop01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		"",
+		"ActiveState=deactivating\nMainPID=1234",
+		"ActiveState=deactivating\nMainPID=1234",
+		"",
+		"ActiveState=inactive\nMainPID=0"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{
+		name:      "myname",
+		killAfter: time.Second,
+		action:    "stop"}
+
+	// when
+	result, err := r.Stop(service, handler)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if result.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", result)
+	}
+
+	if mock.runs[3] != "sudo systemctl kill -s KILL myname" {
+		t.Error("Expected other, got ", mock.runs[3])
+	}
+}
+
+// Stop times out and the service is killed using its pid
+func TestServiceExecServiceHandlerStop02(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		"",
+		"myname is running (1234)",
+		"",
+		"myname is stopped"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+	service := Service{
+		name:      "myname",
+		force:     true,
+		killAfter: time.Millisecond,
+		action:    "stop"}
+
+	// when
+	result, err := r.Stop(service, handler)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if result.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", result)
+	}
+
+	if mock.runs[2] != "sudo kill -9 1234" {
+		t.Error("Expected other, got ", mock.runs[2])
+	}
+}
+
+// Windows Service is killed with taskkill
+func TestWindowsToWindowsKill01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "stop"}
+
+	// when
+	err := r.Kill(service, handler, 4242)
+	errNoPid := r.Kill(service, handler, 0)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if errNoPid == nil {
+		t.Error("Expected Errors, got none")
+	}
+
+	if mock.run != 1 || mock.runs[0] != "taskkill /S myhost /F /PID 4242" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// Restart a stopped Windows Service starts it
+func TestWindowsToWindowsRestart01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`SERVICE_NAME: myname
+        STATE              : 1  STOPPED`,
+		"",
+		`SERVICE_NAME: myname
+        STATE              : 4  RUNNING
+        PID                : 4242`,
+	}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "myname", action: "restart"}
+
+	// when
+	result, _ := r.Restart(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted || result.PID != 4242 {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if mock.run != 3 || mock.runs[1] != "sc \\\\myhost start myname" {
+		t.Error("Expected start only, got ", mock.runs)
+	}
+}
+
+// Restart a systemd unit natively
+func TestSystemctlServiceHandlerRestart01(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"", "ActiveState=active\nMainPID=5678"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", action: "restart"}
+
+	// when
+	result, _ := r.Restart(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted || result.PID != 5678 {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if mock.run != 2 || mock.runs[0] != "sudo systemctl restart myname" {
+		t.Error("Expected other, got ", mock.runs)
+	}
+}
+
+// Restart with --force stops and starts separately
+func TestSystemctlServiceHandlerRestart02(t *testing.T) {
+
+	// given
+	mock := MockProtocolHandler{results: [20]string{"ActiveState=active", "", "ActiveState=inactive", "", "ActiveState=active"}}
+
+	handler := ProtocolHandler(&mock)
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "myname", force: true, action: "restart"}
+
+	// when
+	result, _ := r.Restart(service, handler)
+
+	// then
+	if result.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", result)
+	}
+
+	if mock.runs[1] != "sudo systemctl stop myname" || mock.runs[3] != "sudo systemctl start myname" {
+		t.Error("Expected stop and start, got ", mock.runs)
+	}
+}
+
+// test wait-for returns once the service is started
+func TestWaitFor01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is stopped", "myname is stopped", "myname is running"}}
+
+	service := Service{name: "myname", timeout: time.Minute, wait: WaitPolicy{Interval: time.Millisecond, Backoff: 2}}
+
+	// when
+	state, err := WaitFor(service, &mock, &ServiceExecServiceHandler{}, ServiceStatusStarted)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", state)
+	}
+
+	if mock.run != 3 {
+		t.Error("Expected runs of 3, got ", mock.run)
+	}
+}
+
+// test wait-for gives up after the timeout
+func TestWaitFor02(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is stopped", "myname is stopped", "myname is stopped", "myname is stopped", "myname is stopped", "myname is stopped", "myname is stopped"}}
+
+	service := Service{name: "myname", timeout: 10 * time.Millisecond, wait: WaitPolicy{Interval: 4 * time.Millisecond}}
+
+	// when
+	state, err := WaitFor(service, &mock, &ServiceExecServiceHandler{}, ServiceStatusStarted)
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error("Expected time out, got ", err)
+	}
+
+	if state.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", state)
+	}
+}
+
+// test the delay between status checks backs off up to the maximum
+func TestStatusPollNext01(t *testing.T) {
+	// given
+	poll := StatusPoll{Backoff: 2}
+
+	// when
+	next := poll.next(time.Second)
+	capped := poll.next(20 * time.Second)
+
+	// then
+	if next != 2*time.Second {
+		t.Error("Expected 2s, got ", next)
+	}
+
+	if capped != MaxPollInterval {
+		t.Error("Expected 30s, got ", capped)
+	}
+}
+
+// test start returns right away with --no-wait
+func TestStartNoWait01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"", "myname is stopped"}}
+
+	service := Service{name: "myname", wait: WaitPolicy{NoWait: true}}
+
+	// when
+	state, err := StartOrStopWithRetry(service, &mock, &ServiceExecServiceHandler{}, "service myname start", ServiceStatusStarted)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", state)
+	}
+
+	if mock.run != 2 {
+		t.Error("Expected runs of 2, got ", mock.run)
+	}
+}
+
+// test stop gives up after the wait timeout
+func TestStopWaitTimeout01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"", "myname is running", "myname is running", "myname is running", "myname is running", "myname is running", "myname is running"}}
+
+	service := Service{name: "myname", wait: WaitPolicy{Timeout: 10 * time.Millisecond, Interval: 4 * time.Millisecond, Jitter: 0.5}}
+
+	// when
+	state, err := StartOrStopWithRetry(service, &mock, &ServiceExecServiceHandler{}, "service myname stop", ServiceStatusStopped)
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error("Expected time out, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", state)
+	}
+}
+
+// test start of a service that does not exist fails without waiting
+func TestStartNotFound01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname: unrecognized service", "myname: unrecognized service", "myname: unrecognized service"}}
+
+	service := Service{name: "myname", wait: WaitPolicy{Timeout: time.Minute, Interval: time.Minute}}
+
+	// when
+	_, err := StartOrStopWithRetry(service, &mock, &ServiceExecServiceHandler{}, "service myname start", ServiceStatusStarted)
+
+	// then
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Error("Expected service not found, got ", err)
+	}
+
+	if mock.runs[1] != "sudo service myname status" || mock.runs[2] != "sudo tail -n 20 /var/log/myname.log" {
+		t.Error("Expected a single status check and the logs, got ", mock.runs)
+	}
+}
+
+// Search units of systemctl with their start type
+func TestSystemctlServiceHandlerSearch01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		`cron.service loaded active running Regular background program processing daemon
+my.name.service loaded failed failed My Name
+mynameXservice.service loaded active running Not a dot`,
+		`cron.service enabled enabled
+my.name.service disabled enabled
+my.name-old.service masked enabled`}}
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+	service := Service{name: "my.name", action: "search"}
+
+	// when
+	result, err := r.Search(service, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatal("Expected 2 result, got ", result)
+	}
+
+	if result[0].Name != "my.name" || result[0].DisplayName != "My Name" || result[0].State.Status != ServiceStatusFailed || result[0].State.StartType != "disabled" {
+		t.Error("Expected my.name failed and disabled, got ", result[0])
+	}
+
+	if result[1].Name != "my.name-old" || result[1].State.Status != ServiceStatusDisabled {
+		t.Error("Expected my.name-old disabled, got ", result[1])
+	}
+}
+
+// Search with glob, regex and exact matching and a state filter
+func TestSearch01(t *testing.T) {
+	// given
+	entries := []ServiceEntry{
+		{Name: "tomcat", State: ServiceState{Status: ServiceStatusStarted}},
+		{Name: "tomcat-admin", State: ServiceState{Status: ServiceStatusStopped}},
+		{Name: "mytomcat", DisplayName: "tomcat [legacy]", State: ServiceState{Status: ServiceStatusDisabled}},
+	}
+
+	tests := []struct {
+		service  Service
+		expected int
+	}{
+		{Service{name: "tomcat"}, 3},
+		{Service{name: "tomcat [", match: ""}, 1},
+		{Service{name: "tomcat*", match: "glob"}, 3},
+		{Service{name: "^tomcat$", match: "regex"}, 1},
+		{Service{name: "tomcat", match: "exact"}, 1},
+		{Service{name: "tomcat", stateFilter: "stopped"}, 2},
+		{Service{name: "TomCat"}, 3},
+		{Service{name: "TOMCAT*", match: "glob"}, 3},
+		{Service{name: "^TOMCAT$", match: "regex"}, 1},
+		{Service{name: "Tomcat", match: "exact"}, 1},
+	}
+
+	for _, test := range tests {
+
+		// when
+		result, err := Search(test.service, entries, nil)
+
+		// then
+		if err != nil {
+			t.Error("Expected NO Errors, got ", err)
+		}
+
+		if len(result) != test.expected {
+			t.Error("Expected ", test.expected, " results for ", test.service.name, ", got ", result)
+		}
+	}
+}
+
+// Search reports an invalid regex
+func TestSearch02(t *testing.T) {
+	// when
+	_, err := Search(Service{name: "tomcat[", match: "regex"}, []ServiceEntry{{Name: "tomcat"}}, nil)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+}
+
+// List every Windows Service with sc query
+func TestWindowsToWindowsList01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{`
+SERVICE_NAME: AJRouter
+DISPLAY_NAME: AllJoyn Router Service
+        TYPE               : 20  WIN32_SHARE_PROCESS
+        STATE              : 1  STOPPED
+        WIN32_EXIT_CODE    : 1077  (0x435)
+
+SERVICE_NAME: Spooler
+DISPLAY_NAME: Print Spooler
+        TYPE               : 110  WIN32_OWN_PROCESS  (interactive)
+        STATE              : 4  RUNNING
+                                (STOPPABLE, NOT_PAUSABLE, IGNORES_SHUTDOWN)
+`}}
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", action: "list"}
+
+	// when
+	result, err := r.List(service, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatal("Expected 2 result, got ", result)
+	}
+
+	if result[0].Name != "AJRouter" || result[0].DisplayName != "AllJoyn Router Service" || result[0].State.Status != ServiceStatusStopped {
+		t.Error("Expected AJRouter stopped, got ", result[0])
+	}
+
+	if result[1].Name != "Spooler" || result[1].State.Status != ServiceStatusStarted {
+		t.Error("Expected Spooler started, got ", result[1])
+	}
+
+	if mock.runs[0] != "sc \\\\myhost query state= all" {
+		t.Error("Expected other, got ", mock.runs[0])
+	}
+}
+
+// LSB exit codes decide the status over the text of the init script
+func TestServiceExecServiceHandlerStatusExitCode01(t *testing.T) {
+
+	tests := []struct {
+		stdout   string
+		code     int
+		expected int
+	}{
+		{"myname is up, will stop on shutdown", 0, ServiceStatusStarted},
+		{"myname is running?", 3, ServiceStatusStopped},
+		{"myname dead, pid file exists", 1, ServiceStatusFailed},
+		{"myname: unrecognized service", 1, ServiceStatusNotFound},
+		{"myname is running", 4, ServiceStatusUnknown},
+		{"myname will stop on shutdown, start pending", 4, ServiceStatusUnknown},
+		{"myname is running", 150, ServiceStatusUnknown},
+		{"myname is running", NoExitCode, ServiceStatusStarted},
+	}
+
+	for _, test := range tests {
+
+		// given
+		mock := MockExitCodeProtocolHandler{
+			MockProtocolHandler: MockProtocolHandler{results: [20]string{test.stdout}},
+			codes:               [20]int{test.code}}
+
+		r := ServiceHandler(&ServiceExecServiceHandler{})
+
+		// when
+		state, err := r.Status(Service{name: "myname", action: "status"}, &mock)
+
+		// then
+		if err != nil {
+			t.Error("Expected NO Errors, got ", err)
+		}
+
+		if state.Status != test.expected {
+			t.Error("Expected ", ServiceStatus[test.expected], " for ", test.stdout, " exiting ", test.code, ", got ", ServiceStatus[state.Status])
+		}
+	}
+}
+
+// the status of localized sc output is read from the numeric state
+func TestParseScStatusLocalized01(t *testing.T) {
+
+	tests := []struct {
+		fixture  string
+		expected int
+		pid      int
+	}{
+		{"testdata/sc_queryex_de.txt", ServiceStatusStarted, 2148},
+		{"testdata/sc_queryex_fr.txt", ServiceStatusStopping, 3312},
+	}
+
+	for _, test := range tests {
+
+		// given
+		stdout, err := os.ReadFile(test.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// when
+		state := parseScStatus(string(stdout))
+
+		// then
+		if state.Status != test.expected || state.PID != test.pid {
+			t.Error("Expected ", ServiceStatus[test.expected], " with pid ", test.pid, " for ", test.fixture, ", got ", state)
+		}
+	}
+}
+
+// the start type of localized sc qc output is read from its numeric code
+func TestParseScConfigLocalized01(t *testing.T) {
+	// given
+	stdout, err := os.ReadFile("testdata/sc_qc_de.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	config := parseScConfig(string(stdout))
+
+	// then
+	if config.StartType != "auto" {
+		t.Error("Expected auto, got ", config.StartType)
+	}
+
+	if config.Binary != `C:\Windows\System32\spoolsv.exe` {
+		t.Error("Expected spoolsv.exe, got ", config.Binary)
+	}
+
+	if config.DisplayName != "Druckwarteschlange" {
+		t.Error("Expected Druckwarteschlange, got ", config.DisplayName)
+	}
+
+	if config.Account != "LocalSystem" {
+		t.Error("Expected LocalSystem, got ", config.Account)
+	}
+}
+
+// the dependencies of localized sc qc output are found without their labels
+func TestWindowsToWindowsDependenciesLocalized01(t *testing.T) {
+	// given
+	stdout, err := os.ReadFile("testdata/sc_qc_de.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := MockProtocolHandler{results: [20]string{string(stdout), ""}}
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+	service := Service{host: "myhost", name: "Spooler", action: "deps"}
+
+	// when
+	deps, err := r.Dependencies(service, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(deps.Dependencies) != 2 || deps.Dependencies[0] != "RPCSS" || deps.Dependencies[1] != "http" {
+		t.Error("Expected RPCSS and http, got ", deps.Dependencies)
+	}
+}
+
+// the services of localized sc query output are found without their labels
+func TestParseScQueryLocalized01(t *testing.T) {
+	// given
+	stdout, err := os.ReadFile("testdata/sc_query_fr.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	entries := parseScQuery(string(stdout))
+
+	// then
+	if len(entries) != 2 {
+		t.Fatal("Expected 2 entries, got ", entries)
+	}
+
+	if entries[0].Name != "AJRouter" || entries[0].DisplayName != "Service de routeur AllJoyn" || entries[0].State.Status != ServiceStatusStopped {
+		t.Error("Expected AJRouter stopped, got ", entries[0])
+	}
+
+	if entries[1].Name != "Spooler" || entries[1].State.Status != ServiceStatusStarted {
+		t.Error("Expected Spooler started, got ", entries[1])
+	}
+}
+
+// Status of several units with one systemctl show
+func TestSystemctlServiceHandlerStatusAll01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"86400.00 170000.00\nLoadState=loaded\nActiveState=active\nMainPID=812\nActiveEnterTimestampMonotonic=3600000000\n\nLoadState=not-found\nActiveState=inactive\nMainPID=0\n\nLoadState=loaded\nActiveState=failed\nMainPID=0\n"}}
+
+	r := ServiceHandler(&SystemctlServiceHandler{})
+
+	// when
+	states, err := r.StatusAll(Service{action: "status"}, []string{"nginx", "nosuch", "cron"}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(states) != 3 || states[0].Status != ServiceStatusStarted || states[0].PID != 812 || states[0].Uptime != 23*time.Hour || states[1].Status != ServiceStatusNotFound || states[2].Status != ServiceStatusFailed {
+		t.Error("Expected started, not found and failed, got ", states)
+	}
+
+	if mock.run != 1 || !strings.HasPrefix(mock.runs[0], "cat /proc/uptime; systemctl show nginx nosuch cron --no-pager -p ") {
+		t.Error("Expected a single systemctl show, got ", mock.runs)
+	}
+}
+
+// Status of several init scripts, the ones service --status-all misses or shows without a state are asked one by one
+func TestServiceExecServiceHandlerStatusAll01(t *testing.T) {
+	// given
+	mock := MockExitCodeProtocolHandler{
+		MockProtocolHandler: MockProtocolHandler{results: [20]string{
+			" [ + ]  nginx\n [ ? ]  myapp\n [ - ]  cron\n",
+			"myapp is running",
+			"mydb: unrecognized service"}},
+		codes: [20]int{0, 3, 1}}
+
+	r := ServiceHandler(&ServiceExecServiceHandler{})
+
+	// when
+	states, err := r.StatusAll(Service{host: "myhost", action: "status"}, []string{"nginx", "myapp", "mydb", "cron"}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(states) != 4 || states[0].Status != ServiceStatusStarted || states[1].Status != ServiceStatusStopped ||
+		states[2].Status != ServiceStatusNotFound || states[3].Status != ServiceStatusStopped {
+		t.Error("Expected started, stopped, not found and stopped, got ", states)
+	}
+
+	if mock.run != 3 || mock.runs[1] != "sudo service myapp status" || mock.runs[2] != "sudo service mydb status" {
+		t.Error("Expected the status of myapp and mydb, got ", mock.runs)
+	}
+}
+
+// Status of several Windows Services with one sc query
+func TestWindowsToWindowsStatusAll01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{`
+SERVICE_NAME: Spooler
+DISPLAY_NAME: Print Spooler
+        TYPE               : 110  WIN32_OWN_PROCESS  (interactive)
+        STATE              : 4  RUNNING
+
+SERVICE_NAME: W32Time
+DISPLAY_NAME: Windows Time
+        TYPE               : 20  WIN32_SHARE_PROCESS
+        STATE              : 1  STOPPED
+`}}
+
+	r := ServiceHandler(&ScExecServiceHandler{})
+
+	// when
+	states, err := r.StatusAll(Service{host: "myhost", action: "status"}, []string{"w32time", "spooler", "nosuch"}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if len(states) != 3 || states[0].Status != ServiceStatusStopped || states[1].Status != ServiceStatusStarted || states[2].Status != ServiceStatusNotFound {
+		t.Error("Expected stopped, started and not found, got ", states)
+	}
+
+	if mock.run != 1 {
+		t.Error("Expected runs of 1, got ", mock.run)
+	}
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 
 	"github.com/docopt/docopt-go"
 	"github.com/howeyc/gopass"
@@ -12,10 +14,36 @@ import (
 	"os/user"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 const DEFAULT_PORT string = "22"
 
+// process exit codes, a status also tells whether the service runs
+const (
+	ExitOK          = 0 // the action succeeded, for status every service is running
+	ExitError       = 1
+	ExitChanged     = 2 // ensure-started or ensure-stopped changed the service
+	ExitStopped     = 3
+	ExitUnknown     = 4
+	ExitNotFound    = 5
+	ExitAuthFailed  = 6
+	ExitUnreachable = 7
+	ExitPermission  = 8
+	ExitTimeout     = 9
+)
+
+// Result is the outcome of running a service's action
+type Result struct {
+	State   ServiceState
+	Changed bool
+	Records []Record
+}
+
 type Service struct {
 	user     string
 	password string
@@ -24,6 +52,40 @@ type Service struct {
 	name     string
 	action   string
 	sudo     string
+	now      bool
+
+	reloadOrRestart bool
+	withDependents  bool
+
+	definition ServiceDefinition
+
+	force     bool
+	killAfter time.Duration
+	pid       int
+
+	since   time.Duration
+	lines   int
+	follow  bool
+	logFile string
+
+	waitFor string
+	timeout time.Duration
+
+	config      Config
+	waitOptions WaitConfig
+	wait        WaitPolicy
+
+	match       string
+	stateFilter string
+	sortBy      string
+	output      string
+	format      string
+
+	names []string
+
+	expect     string
+	warnUptime time.Duration
+	critUptime time.Duration
 }
 
 var (
@@ -31,15 +93,95 @@ var (
 )
 
 const (
-	ServiceStatusUnknown = iota
-	ServiceStatusStopped = iota
-	ServiceStatusStarted = iota
+	ServiceStatusUnknown  = iota
+	ServiceStatusStopped  = iota
+	ServiceStatusStarted  = iota
+	ServiceStatusStarting = iota
+	ServiceStatusStopping = iota
+	ServiceStatusFailed   = iota
+	ServiceStatusPaused   = iota
+	ServiceStatusDisabled = iota
+	ServiceStatusNotFound = iota
+	ServiceStatusPausing  = iota
+	ServiceStatusResuming = iota
 )
 
 var ServiceStatus = [...]string{
 	"unknown",
 	"stopped",
 	"started",
+	"starting",
+	"stopping",
+	"failed",
+	"paused",
+	"disabled",
+	"not found",
+	"pausing",
+	"continuing",
+}
+
+// ServiceState is a handler's view of a service at one point in time
+type ServiceState struct {
+	Status      int
+	SubState    string
+	PID         int
+	Uptime      time.Duration
+	StartType   string
+	Description string
+	Output      string
+}
+
+// Is reports whether the state satisfies status, a disabled or failed service is also stopped as it does not run
+func (s ServiceState) Is(status int) bool {
+	return s.Status == status || (status == ServiceStatusStopped && (s.Status == ServiceStatusDisabled || s.Status == ServiceStatusFailed))
+}
+
+// IsEnabled reports whether the service is started at boot
+func (s ServiceState) IsEnabled() bool {
+
+	switch strings.ToLower(s.StartType) {
+	case "auto", "auto_start", "delayed-auto", "boot", "boot_start", "system", "system_start", "enabled", "enabled-runtime":
+		return true
+	}
+
+	return false
+}
+
+func (s ServiceState) Describe(name string) string {
+
+	details := []string{}
+
+	if s.SubState != "" {
+		details = append(details, s.SubState)
+	}
+
+	if s.PID > 0 {
+		details = append(details, fmt.Sprintf("pid %d", s.PID))
+	}
+
+	if s.Uptime > 0 {
+		details = append(details, fmt.Sprintf("up %s", s.Uptime))
+	}
+
+	if s.StartType != "" {
+		if s.IsEnabled() {
+			details = append(details, fmt.Sprintf("start type %s, enabled at boot", s.StartType))
+		} else {
+			details = append(details, fmt.Sprintf("start type %s", s.StartType))
+		}
+	}
+
+	str := fmt.Sprintf("service %s is %s", name, ServiceStatus[s.Status])
+
+	if len(details) > 0 {
+		str = fmt.Sprintf("%s (%s)", str, strings.Join(details, ", "))
+	}
+
+	if s.Description != "" {
+		str = fmt.Sprintf("%s - %s", str, s.Description)
+	}
+
+	return str
 }
 
 func updateOptions(service Service, options map[string]interface{}) Service {
@@ -76,6 +218,34 @@ func updateOptions(service Service, options map[string]interface{}) Service {
 		service.action = "search"
 	}
 
+	if options["list"] == true {
+		service.action = "list"
+	}
+
+	if hasKey(options, "--sort") {
+		service.sortBy = options["--sort"].(string)
+	}
+
+	if hasKey(options, "--output") {
+		service.output = options["--output"].(string)
+	}
+
+	// a template replaces the output's fixed format
+	if hasKey(options, "--format") {
+		service.format = options["--format"].(string)
+		service.output = TemplateOutput
+	}
+
+	for _, match := range []string{"glob", "regex", "exact"} {
+		if options["--"+match] == true {
+			service.match = match
+		}
+	}
+
+	if hasKey(options, "--state") {
+		service.stateFilter = options["--state"].(string)
+	}
+
 	if options["start"] == true {
 		service.action = "start"
 	}
@@ -88,14 +258,215 @@ func updateOptions(service Service, options map[string]interface{}) Service {
 		service.action = "stop"
 	}
 
+	if options["ensure-started"] == true {
+		service.action = "ensure-started"
+	}
+
+	if options["ensure-stopped"] == true {
+		service.action = "ensure-stopped"
+	}
+
 	if options["restart"] == true {
 		service.action = "restart"
 	}
 
+	if options["wait-for"] == true {
+		service.action = "wait-for"
+		service.waitFor = "started"
+
+		if options["stopped"] == true {
+			service.waitFor = "stopped"
+		}
+	}
+
+	if options["check"] == true {
+		service.action = "check"
+		service.expect = ServiceStatus[ServiceStatusStarted]
+	}
+
+	if hasKey(options, "--expect") {
+		service.expect = options["--expect"].(string)
+	}
+
+	if hasKey(options, "--warn-uptime") {
+		service.warnUptime, _ = time.ParseDuration(options["--warn-uptime"].(string))
+	}
+
+	if hasKey(options, "--crit-uptime") {
+		service.critUptime, _ = time.ParseDuration(options["--crit-uptime"].(string))
+	}
+
+	if hasKey(options, "--timeout") {
+		service.timeout, _ = time.ParseDuration(options["--timeout"].(string))
+	}
+
+	if hasKey(options, "--wait-timeout") {
+		service.waitOptions.WaitTimeout = options["--wait-timeout"].(string)
+	}
+
+	if hasKey(options, "--poll-interval") {
+		service.waitOptions.PollInterval = options["--poll-interval"].(string)
+	}
+
+	if hasKey(options, "--backoff") {
+		backoff, err := strconv.ParseFloat(options["--backoff"].(string), 64)
+
+		if err != nil {
+			log.Warn("ignoring invalid --backoff: %s", err.Error())
+		} else {
+			service.waitOptions.Backoff = &backoff
+		}
+	}
+
+	if hasKey(options, "--jitter") {
+		jitter, err := strconv.ParseFloat(options["--jitter"].(string), 64)
+
+		if err != nil {
+			log.Warn("ignoring invalid --jitter: %s", err.Error())
+		} else {
+			service.waitOptions.Jitter = &jitter
+		}
+	}
+
+	if options["--no-wait"] == true {
+		noWait := true
+		service.waitOptions.NoWait = &noWait
+	}
+
+	if hasKey(options, "--config") {
+		config, err := loadConfig(options["--config"].(string))
+
+		if err != nil {
+			log.Warn("ignoring %s", err.Error())
+		}
+
+		service.config = config
+	} else if usr != nil {
+		service.config = defaultConfig(usr.HomeDir)
+	}
+
+	if options["enable"] == true {
+		service.action = "enable"
+	}
+
+	if options["disable"] == true {
+		service.action = "disable"
+	}
+
+	if options["pause"] == true {
+		service.action = "pause"
+	}
+
+	if options["continue"] == true {
+		service.action = "continue"
+	}
+
+	if options["reload"] == true {
+		service.action = "reload"
+	}
+
+	if options["logs"] == true {
+		service.action = "logs"
+	}
+
+	if hasKey(options, "--since") {
+		since, err := time.ParseDuration(options["--since"].(string))
+
+		if err != nil {
+			log.Warn("ignoring invalid --since: %s", err.Error())
+		}
+
+		service.since = since
+	}
+
+	// without --lines, logs shows DefaultLogLines and a failed action attaches DiagnosticLogLines
+	if hasKey(options, "--lines") {
+		service.lines, _ = strconv.Atoi(options["--lines"].(string))
+	} else if service.action == "logs" {
+		service.lines = DefaultLogLines
+	}
+
+	if hasKey(options, "--log-file") {
+		service.logFile = options["--log-file"].(string)
+	}
+
+	if options["config"] == true {
+		service.action = "config"
+	}
+
+	if options["install"] == true {
+		service.action = "install"
+	}
+
+	if options["uninstall"] == true {
+		service.action = "uninstall"
+	}
+
+	if hasKey(options, "--unit-file") {
+		service.definition.UnitFile = options["--unit-file"].(string)
+	}
+
+	if hasKey(options, "--init-script") {
+		service.definition.InitScript = options["--init-script"].(string)
+	}
+
+	if hasKey(options, "--bin-path") {
+		service.definition.BinPath = options["--bin-path"].(string)
+	}
+
+	if hasKey(options, "--display-name") {
+		service.definition.DisplayName = options["--display-name"].(string)
+	}
+
+	if hasKey(options, "--start-type") {
+		service.definition.StartType = options["--start-type"].(string)
+	}
+
+	if options["deps"] == true {
+		service.action = "deps"
+	}
+
+	service.force = options["--force"] == true
+
+	if hasKey(options, "--kill-after") {
+		killAfter, err := time.ParseDuration(options["--kill-after"].(string))
+
+		if err != nil {
+			log.Warn("ignoring invalid --kill-after: %s", err.Error())
+		}
+
+		service.killAfter = killAfter
+	}
+
+	service.withDependents = options["--with-dependents"] == true
+	service.follow = options["--follow"] == true
+	service.now = options["--now"] == true
+	service.reloadOrRestart = options["--reload-or-restart"] == true
+
 	if hasKey(options, "<servicename>") {
 		service.name = options["<servicename>"].(string)
 	}
 
+	// the status of several services is fetched at once
+	if service.action == "status" && strings.Contains(service.name, ",") {
+		service.names = strings.Split(service.name, ",")
+	}
+
+	if service.action == "status" && hasKey(options, "--services-file") {
+
+		names, err := readServicesFile(options["--services-file"].(string))
+
+		if err != nil {
+			log.Warn("ignoring %s", err.Error())
+		}
+
+		if len(service.names) == 0 && service.name != "" {
+			service.names = []string{service.name}
+		}
+
+		service.names = append(service.names, names...)
+	}
+
 	if hasKey(options, "--password") {
 		service.password = options["--password"].(string)
 	}
@@ -104,7 +475,7 @@ func updateOptions(service Service, options map[string]interface{}) Service {
 		service.sudo = options["--sudo"].(string)
 
 		if service.sudo == "" {
-			fmt.Printf(fmt.Sprintf("[sudo] password for %s: ", service.user))
+			fmt.Fprint(console, fmt.Sprintf("[sudo] password for %s: ", service.user))
 			pass := gopass.GetPasswd()
 			service.sudo = string(pass)
 		}
@@ -113,6 +484,29 @@ func updateOptions(service Service, options map[string]interface{}) Service {
 	return service
 }
 
+// readServicesFile reads one service name per line, ignoring empty lines and # comments
+func readServicesFile(file string) ([]string, error) {
+
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read services file %s: %s", file, err.Error())
+	}
+
+	names := []string{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+
+		line = strings.TrimSpace(line)
+
+		if line != "" && !strings.HasPrefix(line, "#") {
+			names = append(names, line)
+		}
+	}
+
+	return names, nil
+}
+
 func hasKey(m map[string]interface{}, key string) bool {
 
 	var exists bool
@@ -136,12 +530,60 @@ Usage:
   sms [options] [user@]<host>[:port] <servicename> restart
   sms [options] [user@]<host>[:port] <servicename> start
   sms [options] [user@]<host>[:port] <servicename> status
+  sms [options] [user@]<host>[:port] status
   sms [options] [user@]<host>[:port] <servicename> stop
+  sms [options] [user@]<host>[:port] <servicename> ensure-started
+  sms [options] [user@]<host>[:port] <servicename> ensure-stopped
+  sms [options] [user@]<host>[:port] <servicename> wait-for (started|stopped)
+  sms [options] [user@]<host>[:port] <servicename> reload
+  sms [options] [user@]<host>[:port] <servicename> pause
+  sms [options] [user@]<host>[:port] <servicename> continue
+  sms [options] [user@]<host>[:port] <servicename> logs
+  sms [options] [user@]<host>[:port] <servicename> deps
+  sms [options] [user@]<host>[:port] <servicename> config
+  sms [options] [user@]<host>[:port] <servicename> install
+  sms [options] [user@]<host>[:port] <servicename> uninstall
+  sms [options] [user@]<host>[:port] <servicename> enable
+  sms [options] [user@]<host>[:port] <servicename> disable
   sms [options] [user@]<host>[:port] search <servicename>
+  sms [options] [user@]<host>[:port] list [<servicename>]
+  sms [options] [user@]<host>[:port] <servicename> check
 
  Options:
   --password=password  password
   --sudo=sudopw  sudo password
+  --now          also start (enable, install) or stop (disable) the service
+  --reload-or-restart  restart the service if it cannot be reloaded
+  --with-dependents  restart stops the services depending on the service first and starts them again afterwards
+  --force        kill the service when stop or restart does not stop it in time
+  --kill-after=duration  time to wait for a graceful stop before killing the service, e.g. 90s
+  --timeout=duration  time wait-for waits for the service [default: 5m]
+  --wait-timeout=duration  time start, stop and the other actions wait for the service, defaults to 30s
+  --poll-interval=duration  delay between status checks, defaults to 1s
+  --backoff=factor  factor the delay between status checks grows by, up to 30s
+  --jitter=fraction  spread every delay between status checks randomly by this fraction, e.g. 0.2
+  --no-wait      return right after sending the command without waiting for the service
+  --config=file  JSON file with wait settings per handler and per service, defaults to ~/.sms.json
+  --glob         search matches the name as a shell pattern, e.g. 'tomcat*'
+  --regex        search matches the name as a regular expression
+  --exact        search only matches the exact name
+  --state=state  search and list only show services in this state, e.g. started or stopped
+  --sort=field   sort the services listed by name, state or enabled [default: name]
+  --output=format  text, table, json, yaml or csv [default: text]
+  --format=template  Go template printed for every result instead of the output, e.g. '{{.Service}} {{.State}}'
+  --services-file=file  status of the services listed in file, one name per line
+  --expect=state  state check requires the service to be in, e.g. stopped, defaults to started
+  --warn-uptime=duration  check warns when the service started less than duration ago, e.g. 10m
+  --crit-uptime=duration  check is critical when the service started less than duration ago
+  --unit-file=file  local systemd unit file to install
+  --init-script=file  local SysV init script to install
+  --bin-path=path  binary of the Windows service to install
+  --display-name=name  display name of the Windows service to install
+  --start-type=type  start type of the service to install, auto, demand or disabled
+  --since=duration  only show logs newer than duration, e.g. 30m
+  --lines=count  number of log lines to show, defaults to 50 and to 20 for a failed action
+  --follow       keep streaming new log lines
+  --log-file=path  log file of a SysV service, defaults to /var/log/<servicename>.log
   -h, --help     show help
   -v, --verbose  show debug info
 `
@@ -150,25 +592,62 @@ Usage:
 
 	service = updateOptions(service, arguments)
 
+	if err == nil {
+		err = checkOptions(arguments)
+	}
+
+	if err == nil {
+		err = checkOutput(service)
+	}
+
 	return service, err
 }
 
-func run(service Service) error {
+// checkOptions rejects options that would change what the action does when they are ignored, before connecting
+func checkOptions(options map[string]interface{}) error {
+
+	for _, name := range []string{"--timeout", "--warn-uptime", "--crit-uptime"} {
+		if hasKey(options, name) {
+			if _, err := time.ParseDuration(options[name].(string)); err != nil {
+				return fmt.Errorf("invalid %s: %s", name, err.Error())
+			}
+		}
+	}
+
+	if hasKey(options, "--state") {
+		if state := options["--state"].(string); statusByName(state) == ServiceStatusUnknown && state != ServiceStatus[ServiceStatusUnknown] {
+			return fmt.Errorf("invalid --state: %s", state)
+		}
+	}
+
+	if hasKey(options, "--expect") {
+		if expect := options["--expect"].(string); statusByName(expect) == ServiceStatusUnknown {
+			return fmt.Errorf("invalid --expect: %s", expect)
+		}
+	}
+
+	return nil
+}
+
+func run(service Service) (Result, error) {
 
 	var err error
-	var strs []string
+	var result Result
 	completed := false
+	connected := false
 
 	protocols := [...]ProtocolHandler{
 		ProtocolHandler(&SSHProtocolHandler{}),
 		ProtocolHandler(&WindowsProtocolHandler{}),
 	}
 
-	handlers := [...]ServiceHandler{
+	// external handler plugins get the first chance to claim the service
+	handlers := append(discoverPlugins(service),
+		ServiceHandler(&SystemctlServiceHandler{}),
 		ServiceHandler(&ServiceExecServiceHandler{}),
 		ServiceHandler(&ScExecServiceHandler{}),
 		ServiceHandler(&SambaServiceHandler{}),
-	}
+	)
 
 	for _, protocol := range protocols {
 
@@ -179,7 +658,7 @@ func run(service Service) error {
 
 			if protocol.IsPasswordNeeded(service) && service.password == "" {
 
-				fmt.Printf(fmt.Sprintf("%s@%s's Password: ", service.user, service.host))
+				fmt.Fprint(console, fmt.Sprintf("%s@%s's Password: ", service.user, service.host))
 				pass := gopass.GetPasswd()
 				service.password = string(pass)
 			}
@@ -187,6 +666,8 @@ func run(service Service) error {
 			err = protocol.OpenConnection(service)
 
 			if err == nil {
+				connected = true
+
 				for _, handler := range handlers {
 
 					handler_supported := handler.IsSupported(protocol)
@@ -194,67 +675,409 @@ func run(service Service) error {
 
 					if handler_supported {
 
-						if service.action == "search" {
+						service.wait = waitPolicy(service, handler)
+						log.Debug("waiting for the service with %+v", service.wait)
 
-							strs, err = handler.Search(service, protocol)
+						start := time.Now()
+						result, err = runAction(service, handler, protocol)
+						timed(result.Records, start)
 
-							if err == nil {
-								for _, element := range strs {
-									fmt.Println(element)
-								}
-							}
+						completed = true
+						break
+					}
 
-						} else {
+				}
 
-							status := ServiceStatusUnknown
+				protocol.CloseConnection(service)
+			} else {
 
-							if service.action == "status" {
-								status, err = handler.Status(service, protocol)
-							} else if service.action == "start" {
-								status, err = handler.Start(service, protocol)
-							} else if service.action == "stop" {
-								status, err = handler.Stop(service, protocol)
-							} else if service.action == "restart" {
+				completed = true
+			}
+		}
 
-								status, err = handler.Status(service, protocol)
+		if completed {
+			break
+		}
+	}
 
-								if err == nil && status == ServiceStatusStarted {
-									status, err = handler.Stop(service, protocol)
-								}
+	// a host that answers but has no service manager sms knows is not a connection problem
+	if !completed && err == nil && connected {
+		err = fmt.Errorf("none of the service managers of %s is supported", service.host)
+	} else if !completed && err == nil {
+		err = fmt.Errorf("%w: %s", ErrUnreachable, service.host)
+	}
 
-								if err == nil && status == ServiceStatusStopped {
-									status, err = handler.Start(service, protocol)
-								}
-							}
+	return result, err
+}
 
-							if err == nil {
-								fmt.Println(fmt.Sprintf("service %s is %s", service.name, ServiceStatus[status]))
-							}
-						}
+// runAction performs the service's action using the selected handler and prints the result
+func runAction(service Service, handler ServiceHandler, protocol ProtocolHandler) (Result, error) {
 
-						if err != nil {
-							fmt.Println(fmt.Sprintf("an error ocurred %s", err.Error()))
-						}
+	var err error
+	var state ServiceState
+	var config ServiceConfig
+	var result Result
 
-						completed = true
-						break
-					}
+	switch service.action {
+	case "search", "list":
+		var entries []ServiceEntry
 
-				}
+		if service.action == "search" {
+			entries, err = handler.Search(service, protocol)
+		} else {
+			entries, err = handler.List(service, protocol)
+			entries, err = Search(service, entries, err)
+			sortEntries(entries, service.sortBy)
+		}
 
-				protocol.CloseConnection(service)
-			} else {
+		for _, entry := range entries {
+			record := newRecord(service, entry.Name, handler, protocol, entry.State)
+			record.Description = entry.DisplayName
+			result.Records = append(result.Records, record)
+		}
 
-				completed = true
+		if err == nil && !isStructured(service.output) {
+			printEntries(entries)
+		}
+
+	case "status":
+		if service.name == "" && len(service.names) == 0 {
+			err = errors.New("status needs a service name or --services-file")
+			break
+		}
+
+		if len(service.names) > 0 {
+			var states []ServiceState
+			states, err = handler.StatusAll(service, service.names, protocol)
+
+			for i, s := range states {
+				fmt.Fprintln(console, s.Describe(service.names[i]))
+				result.Records = append(result.Records, newRecord(service, service.names[i], handler, protocol, s))
 			}
+			break
 		}
 
-		if completed {
+		state, err = handler.Status(service, protocol)
+
+		if err == nil && state.StartType == "" {
+			state.StartType, err = handler.StartType(service, protocol)
+		}
+
+	case "start":
+		state, err = handler.Start(service, protocol)
+
+	case "stop":
+		state, err = handler.Stop(service, protocol)
+
+	case "ensure-started":
+		state, result.Changed, err = ensure(service, handler, protocol, ServiceStatusStarted)
+
+	case "ensure-stopped":
+		state, result.Changed, err = ensure(service, handler, protocol, ServiceStatusStopped)
+
+	case "wait-for":
+		wanted := ServiceStatusStarted
+		if service.waitFor == "stopped" {
+			wanted = ServiceStatusStopped
+		}
+
+		state, err = WaitFor(service, protocol, handler, wanted)
+
+	case "restart":
+		state, err = restart(service, handler, protocol)
+
+	case "reload":
+		state, err = reload(service, handler, protocol)
+
+	case "pause":
+		state, err = handler.Pause(service, protocol)
+
+	case "continue":
+		state, err = handler.Continue(service, protocol)
+
+	case "logs":
+		err = handler.Logs(service, protocol, os.Stdout)
+
+	case "deps":
+		var deps ServiceDependencies
+		deps, err = handler.Dependencies(service, protocol)
+
+		if err == nil {
+			fmt.Fprintln(console, fmt.Sprintf("dependencies of %s:", service.name))
+			for _, name := range deps.Dependencies {
+				fmt.Fprintln(console, "  "+name)
+			}
+
+			fmt.Fprintln(console, fmt.Sprintf("dependents of %s:", service.name))
+			for _, name := range deps.Dependents {
+				fmt.Fprintln(console, "  "+name)
+			}
+
+			record := newRecord(service, service.name, handler, protocol, state)
+			record.Dependencies = deps.Dependencies
+			record.Dependents = deps.Dependents
+			result.Records = append(result.Records, record)
+		}
+
+	case "config":
+		config, err = handler.Config(service, protocol)
+
+		if err == nil {
+			fmt.Fprintln(console, config.Describe(service.name))
+			state, err = handler.Status(service, protocol)
+		}
+
+	case "check":
+		state, err = handler.Status(service, protocol)
+
+	case "install":
+		state, err = handler.Install(service, protocol)
+
+	case "uninstall":
+		state, err = handler.Uninstall(service, protocol)
+
+	case "enable":
+		state, err = handler.Enable(service, protocol)
+
+	case "disable":
+		state, err = handler.Disable(service, protocol)
+	}
+
+	if service.action != "search" && service.action != "list" && service.action != "logs" && service.action != "deps" && len(service.names) == 0 {
+
+		if err == nil {
+			fmt.Fprintln(console, state.Describe(service.name))
+		}
+
+		if err == nil && strings.HasPrefix(service.action, "ensure-") {
+			fmt.Fprintln(console, fmt.Sprintf("changed: %t", result.Changed))
+		}
+
+		log.Debug("handler output: %s", state.Output)
+
+		record := newRecord(service, service.name, handler, protocol, state)
+		record.Changed = result.Changed
+		record.applyConfig(config)
+		result.Records = append(result.Records, record)
+	}
+
+	if err != nil {
+		fmt.Fprintln(console, fmt.Sprintf("an error ocurred %s", err.Error()))
+	}
+
+	result.State = state
+
+	return result, err
+}
+
+// ensure starts or stops the service only when it is not already in the wanted status, reporting whether it changed
+func ensure(service Service, handler ServiceHandler, protocol ProtocolHandler, wantedStatus int) (ServiceState, bool, error) {
+
+	state, err := handler.Status(service, protocol)
+
+	if err != nil || state.Is(wantedStatus) {
+		return state, false, err
+	}
+
+	if state.Is(ServiceStatusNotFound) {
+		return state, false, fmt.Errorf("%w: %s", ErrServiceNotFound, service.name)
+	}
+
+	if wantedStatus == ServiceStatusStarted {
+		state, err = handler.Start(service, protocol)
+	} else {
+		state, err = handler.Stop(service, protocol)
+	}
+
+	return state, true, err
+}
+
+func restart(service Service, handler ServiceHandler, protocol ProtocolHandler) (ServiceState, error) {
+
+	if service.withDependents {
+		return restartWithDependents(service, handler, protocol)
+	}
+
+	before, err := handler.Status(service, protocol)
+
+	if err != nil {
+		return before, err
+	}
+
+	state, err := handler.Restart(service, protocol)
+
+	if err == nil {
+		fmt.Fprintln(console, strings.Replace(before.Describe(service.name), " is ", " was ", 1))
+		printPIDChange(before, state)
+	}
+
+	return state, err
+}
+
+// restartWithDependents stops the running dependents, restarts the service and then starts the dependents again in reverse order
+func restartWithDependents(service Service, handler ServiceHandler, protocol ProtocolHandler) (ServiceState, error) {
+
+	deps, err := handler.Dependencies(service, protocol)
+
+	if err != nil {
+		return ServiceState{Status: ServiceStatusUnknown}, err
+	}
+
+	state := ServiceState{Status: ServiceStatusUnknown}
+	stopped := []Service{}
+
+	for _, name := range deps.Dependents {
+
+		dependent := service
+		dependent.name = name
+
+		var dependentState ServiceState
+		dependentState, err = handler.Status(dependent, protocol)
+
+		if err == nil && dependentState.Is(ServiceStatusStarted) {
+			fmt.Fprintln(console, fmt.Sprintf("stopping dependent service %s", name))
+			stopped = append(stopped, dependent)
+			dependentState, err = handler.Stop(dependent, protocol)
+		}
+
+		if err != nil {
+			state = dependentState
 			break
 		}
 	}
 
-	return err
+	if err == nil {
+		service.withDependents = false
+		state, err = restart(service, handler, protocol)
+	}
+
+	// the dependents stopped so far are started again even when the restart failed
+	failed := []string{}
+
+	for i := len(stopped) - 1; i >= 0; i-- {
+		fmt.Fprintln(console, fmt.Sprintf("starting dependent service %s", stopped[i].name))
+
+		if _, startErr := handler.Start(stopped[i], protocol); startErr != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", stopped[i].name, strings.SplitN(startErr.Error(), "\n", 2)[0]))
+		}
+	}
+
+	if len(failed) > 0 {
+
+		msg := fmt.Sprintf("dependent services not started again: %s", strings.Join(failed, ", "))
+
+		if err != nil {
+			err = fmt.Errorf("%w\n%s", err, msg)
+		} else {
+			err = errors.New(msg)
+		}
+	}
+
+	return state, err
+}
+
+// reload asks the handler for a native reload, confirms the service is still running and reports whether the PID was preserved
+func reload(service Service, handler ServiceHandler, protocol ProtocolHandler) (ServiceState, error) {
+
+	before, err := handler.Status(service, protocol)
+
+	if err != nil {
+		return before, err
+	}
+
+	state, err := handler.Reload(service, protocol)
+
+	if err != nil && service.reloadOrRestart {
+		log.Info("reload failed (%s), restarting %s", err.Error(), service.name)
+		state, err = restart(service, handler, protocol)
+	}
+
+	if err == nil && !state.Is(ServiceStatusStarted) {
+		err = fmt.Errorf("service %s is %s after reload", service.name, ServiceStatus[state.Status])
+	}
+
+	if err == nil {
+		printPIDChange(before, state)
+	}
+
+	return state, err
+}
+
+// printEntries prints the services found by search or list as a table
+func printEntries(entries []ServiceEntry) {
+
+	w := tabwriter.NewWriter(console, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tENABLED\tDISPLAY NAME")
+
+	for _, entry := range entries {
+
+		enabled := "-"
+		if entry.State.StartType != "" {
+			enabled = strconv.FormatBool(entry.State.IsEnabled())
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, ServiceStatus[entry.State.Status], enabled, entry.DisplayName)
+	}
+
+	w.Flush()
+}
+
+// sortEntries sorts by name, state or enabled, services with the same state are sorted by name
+func sortEntries(entries []ServiceEntry, by string) {
+
+	sort.SliceStable(entries, func(i, j int) bool {
+
+		a, b := entries[i], entries[j]
+
+		switch {
+		case by == "state" && a.State.Status != b.State.Status:
+			return ServiceStatus[a.State.Status] < ServiceStatus[b.State.Status]
+		case by == "enabled" && a.State.IsEnabled() != b.State.IsEnabled():
+			return a.State.IsEnabled()
+		}
+
+		return a.Name < b.Name
+	})
+}
+
+func printPIDChange(before ServiceState, after ServiceState) {
+
+	if before.PID > 0 && after.PID > 0 {
+		if before.PID == after.PID {
+			fmt.Fprintln(console, fmt.Sprintf("pid %d preserved", after.PID))
+		} else {
+			fmt.Fprintln(console, fmt.Sprintf("pid changed from %d to %d", before.PID, after.PID))
+		}
+	}
+}
+
+// printRecords writes the results in the structured output, an error without results becomes a record of its own
+func printRecords(service Service, result Result, err error) error {
+
+	records := result.Records
+
+	if err != nil && len(records) == 0 {
+
+		status := ServiceStatusUnknown
+		if errors.Is(err, ErrServiceNotFound) {
+			status = ServiceStatusNotFound
+		}
+
+		records = []Record{{Host: service.host, Service: service.name, Action: service.action, State: ServiceStatus[status]}}
+	}
+
+	for i := range records {
+		if err != nil && records[i].Error == "" {
+			records[i].Error = err.Error()
+			records[i].Reason = errorReason(err)
+		}
+	}
+
+	if service.output == TemplateOutput {
+		return writeTemplate(os.Stdout, service.format, records)
+	}
+
+	return writeRecords(os.Stdout, service.output, records)
 }
 
 func main() {
@@ -262,12 +1085,80 @@ func main() {
 	service, err := usage(os.Args[1:], true)
 
 	if err == nil {
-		err = run(service)
+
+		// monitoring reads the check's single line from stdout
+		if isStructured(service.output) || service.action == "check" {
+			console = os.Stderr
+		}
+
+		result, err := run(service)
+
+		if service.action == "check" {
+			code, line := evaluateCheck(service, result, err)
+			fmt.Println(line)
+			os.Exit(code)
+		}
 
 		if err != nil {
-			fmt.Println(err.Error())
+			fmt.Fprintln(console, err.Error())
+		}
+
+		if isStructured(service.output) {
+			if perr := printRecords(service, result, err); perr != nil {
+				fmt.Fprintln(os.Stderr, perr.Error())
+				os.Exit(ExitError)
+			}
+		}
+
+		os.Exit(exitCode(service, result, err))
+	}
+
+	// monitoring shows a bad argument like any other check it could not run
+	if service.action == "check" {
+		fmt.Println(checkLine(CheckUnknown, err.Error(), ""))
+		os.Exit(CheckUnknown)
+	}
+
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(ExitError)
+}
+
+// exitCode tells scripts how the action went, a status is 0 only when every service is running
+func exitCode(service Service, result Result, err error) int {
+
+	if err != nil {
+		return errorExitCode(err)
+	}
+
+	if result.Changed {
+		return ExitChanged
+	}
+
+	code := ExitOK
+
+	if service.action == "status" {
+		for _, record := range result.Records {
+			if c := statusExitCode(statusByName(record.State)); c > code {
+				code = c
+			}
 		}
 	}
+
+	return code
+}
+
+func statusExitCode(status int) int {
+
+	switch status {
+	case ServiceStatusStarted:
+		return ExitOK
+	case ServiceStatusStopped, ServiceStatusFailed, ServiceStatusDisabled, ServiceStatusPaused:
+		return ExitStopped
+	case ServiceStatusNotFound:
+		return ExitNotFound
+	}
+
+	return ExitUnknown
 }
 
 func isFileFound(file string) bool {
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 // test no parameters entered
@@ -313,3 +319,806 @@ func TestUsage13(t *testing.T) {
 		t.Error("Expected servicename, got ", service.name)
 	}
 }
+
+// test describing a service state
+func TestServiceStateDescribe01(t *testing.T) {
+	// given
+	state := ServiceState{
+		Status:      ServiceStatusStarted,
+		SubState:    "running",
+		PID:         1234,
+		Uptime:      time.Hour,
+		StartType:   "auto",
+		Description: "My Service"}
+
+	// when
+	str := state.Describe("myname")
+
+	// then
+	if str != "service myname is started (running, pid 1234, up 1h0m0s, start type auto, enabled at boot) - My Service" {
+		t.Error("Expected other, got ", str)
+	}
+}
+
+// test a disabled service is also stopped
+func TestServiceStateIs01(t *testing.T) {
+	// given
+	state := ServiceState{Status: ServiceStatusDisabled}
+
+	// when
+	stopped := state.Is(ServiceStatusStopped)
+
+	// then
+	if !stopped {
+		t.Error("Expected stopped")
+	}
+}
+
+// test a failed service is also stopped, but not the other way round
+func TestServiceStateIs02(t *testing.T) {
+	// given
+	failed := ServiceState{Status: ServiceStatusFailed}
+	stopped := ServiceState{Status: ServiceStatusStopped}
+
+	// when, then
+	if !failed.Is(ServiceStatusStopped) || !failed.Is(ServiceStatusFailed) {
+		t.Error("Expected failed to be stopped and failed")
+	}
+
+	if stopped.Is(ServiceStatusFailed) {
+		t.Error("Expected stopped not to be failed")
+	}
+}
+
+// test correct ENABLE parameters entered
+func TestUsage14(t *testing.T) {
+	// given
+	vargs := []string{"--now", "testhost", "servicename", "enable"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "enable" {
+		t.Error("Expected <action> enable, got ", service.action)
+	}
+
+	if !service.now {
+		t.Error("Expected --now")
+	}
+}
+
+// test correct DISABLE parameters entered
+func TestUsage15(t *testing.T) {
+	// given
+	vargs := []string{"testhost", "servicename", "disable"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "disable" {
+		t.Error("Expected <action> disable, got ", service.action)
+	}
+
+	if service.now {
+		t.Error("Expected no --now")
+	}
+}
+
+// test reload keeps the service running with the same pid
+func TestReload01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is running (1234)", "Reloading myname", "myname is running (1234)"}}
+
+	service := Service{
+		user:   "myuser",
+		host:   "myhost",
+		name:   "myname",
+		action: "reload"}
+
+	// when
+	state, err := reload(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted || state.PID != 1234 {
+		t.Error("Expected service started with pid 1234, got ", state)
+	}
+
+	if mock.runs[1] != "sudo service myname reload" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// test reload is not supported and no fallback was requested
+func TestReload02(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is running (1234)", "Usage: /etc/init.d/myname {start|stop|status}"}}
+
+	service := Service{name: "myname", action: "reload"}
+
+	// when
+	_, err := reload(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if err == nil {
+		t.Error("Expected Errors, got none")
+	}
+
+	if mock.run != 2 {
+		t.Error("Expected runs of 2, got ", mock.run)
+	}
+}
+
+// test reload falls back to restart with --reload-or-restart
+func TestReload03(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		"myname is running (1234)",
+		"Usage: /etc/init.d/myname {start|stop|status}",
+		"myname is running (1234)",
+		"",
+		"myname is running (5678)"}}
+
+	service := Service{name: "myname", action: "reload", reloadOrRestart: true}
+
+	// when
+	state, err := reload(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted || state.PID != 5678 {
+		t.Error("Expected service started with pid 5678, got ", state)
+	}
+
+	if mock.runs[3] != "sudo service myname restart" {
+		t.Error("Expected restart, got ", mock.runs)
+	}
+}
+
+// test correct RELOAD parameters entered
+func TestUsage16(t *testing.T) {
+	// given
+	vargs := []string{"--reload-or-restart", "testhost", "servicename", "reload"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "reload" {
+		t.Error("Expected <action> reload, got ", service.action)
+	}
+
+	if !service.reloadOrRestart {
+		t.Error("Expected --reload-or-restart")
+	}
+}
+
+// test correct PAUSE and CONTINUE parameters entered
+func TestUsage17(t *testing.T) {
+	// given
+	pause := []string{"testhost", "servicename", "pause"}
+	cont := []string{"testhost", "servicename", "continue"}
+
+	// when
+	service1, err1 := usage(pause, false)
+	service2, err2 := usage(cont, false)
+
+	// then
+	if err1 != nil || err2 != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service1.action != "pause" {
+		t.Error("Expected <action> pause, got ", service1.action)
+	}
+
+	if service2.action != "continue" {
+		t.Error("Expected <action> continue, got ", service2.action)
+	}
+}
+
+// test correct LOGS parameters entered
+func TestUsage18(t *testing.T) {
+	// given
+	vargs := []string{"--since=2h", "--follow", "testhost", "servicename", "logs"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "logs" {
+		t.Error("Expected <action> logs, got ", service.action)
+	}
+
+	if service.since != 2*time.Hour {
+		t.Error("Expected 2h, got ", service.since)
+	}
+
+	if service.lines != 50 {
+		t.Error("Expected 50 lines, got ", service.lines)
+	}
+
+	if !service.follow {
+		t.Error("Expected --follow")
+	}
+}
+
+// test restart stops dependents first and starts them afterwards
+func TestRestartWithDependents01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{
+		"$network $remote_fs",
+		"/etc/init.d/myapp",
+		"myapp is running",
+		"",
+		"myapp is stopped",
+		"myname is running",
+		"",
+		"myname is running",
+		"",
+		"myapp is running"}}
+
+	service := Service{name: "myname", action: "restart", withDependents: true}
+
+	// when
+	state, err := restart(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", state)
+	}
+
+	if mock.runs[3] != "sudo service myapp stop" {
+		t.Error("Expected other, got ", mock.runs[3])
+	}
+
+	if mock.runs[6] != "sudo service myname restart" {
+		t.Error("Expected restart, got ", mock.runs)
+	}
+
+	if mock.runs[8] != "sudo service myapp start" {
+		t.Error("Expected other, got ", mock.runs[8])
+	}
+}
+
+// test --force and --kill-after parameters
+func TestUsage19(t *testing.T) {
+	// given
+	vargs := []string{"--force", "--kill-after=90s", "testhost", "servicename", "stop"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if !service.force {
+		t.Error("Expected --force")
+	}
+
+	if service.killAfter != 90*time.Second {
+		t.Error("Expected 90s, got ", service.killAfter)
+	}
+}
+
+// test ensure-started starts a stopped service
+func TestEnsure01(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is stopped", "", "myname is running"}}
+
+	service := Service{name: "myname", action: "ensure-started"}
+
+	// when
+	state, changed, err := ensure(service, &ServiceExecServiceHandler{}, &mock, ServiceStatusStarted)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if !changed {
+		t.Error("Expected changed")
+	}
+
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", state)
+	}
+
+	if mock.runs[1] != "sudo service myname start" {
+		t.Error("Expected other, got ", mock.runs[1])
+	}
+}
+
+// test ensure-stopped does nothing for a stopped service
+func TestEnsure02(t *testing.T) {
+	// given
+	mock := MockProtocolHandler{results: [20]string{"myname is stopped"}}
+
+	service := Service{name: "myname", action: "ensure-stopped"}
+
+	// when
+	state, changed, err := ensure(service, &ServiceExecServiceHandler{}, &mock, ServiceStatusStopped)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if changed {
+		t.Error("Expected not changed")
+	}
+
+	if state.Status != ServiceStatusStopped {
+		t.Error("Expected service stopped, got ", state)
+	}
+
+	if mock.run != 1 {
+		t.Error("Expected runs of 1, got ", mock.run)
+	}
+}
+
+// test correct ENSURE-STARTED parameters entered
+func TestUsage20(t *testing.T) {
+	// given
+	vargs := []string{"testhost", "servicename", "ensure-started"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "ensure-started" {
+		t.Error("Expected <action> ensure-started, got ", service.action)
+	}
+}
+
+// test correct WAIT-FOR parameters entered
+func TestUsage21(t *testing.T) {
+	// given
+	vargs := []string{"--timeout=2m", "testhost", "servicename", "wait-for", "stopped"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "wait-for" || service.waitFor != "stopped" {
+		t.Error("Expected wait-for stopped, got ", service.action, service.waitFor)
+	}
+
+	if service.timeout != 2*time.Minute {
+		t.Error("Expected 2m timeout, got ", service.timeout)
+	}
+}
+
+// test the services listed are sorted by state, then by name
+func TestSortEntries01(t *testing.T) {
+	// given
+	entries := []ServiceEntry{
+		{Name: "sshd", State: ServiceState{Status: ServiceStatusStarted}},
+		{Name: "cups", State: ServiceState{Status: ServiceStatusStopped}},
+		{Name: "cron", State: ServiceState{Status: ServiceStatusStarted}},
+	}
+
+	// when
+	sortEntries(entries, "state")
+
+	// then
+	if entries[0].Name != "cron" || entries[1].Name != "sshd" || entries[2].Name != "cups" {
+		t.Error("Expected cron, sshd, cups, got ", entries)
+	}
+}
+
+// test correct LIST parameters entered
+func TestUsage22(t *testing.T) {
+	// given
+	vargs := []string{"--state=started", "--output=json", "testhost", "list"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if service.action != "list" || service.name != "" {
+		t.Error("Expected <action> list without name, got ", service.action, service.name)
+	}
+
+	if service.stateFilter != "started" || service.output != "json" || service.sortBy != "name" {
+		t.Error("Expected started, json and name, got ", service.stateFilter, service.output, service.sortBy)
+	}
+}
+
+// test several services given separated by commas and in a file
+func TestUsage23(t *testing.T) {
+	// given
+	file := filepath.Join(t.TempDir(), "services")
+	os.WriteFile(file, []byte("# web\nnginx\n\nphp-fpm\n"), 0644)
+
+	vargs := []string{"--services-file=" + file, "testhost", "sshd,cron", "status"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got some")
+	}
+
+	if strings.Join(service.names, " ") != "sshd cron nginx php-fpm" {
+		t.Error("Expected sshd cron nginx php-fpm, got ", service.names)
+	}
+}
+
+// test the services of a file without a service name
+func TestUsage24(t *testing.T) {
+	// given
+	file := filepath.Join(t.TempDir(), "services")
+	os.WriteFile(file, []byte("nginx\n"), 0644)
+
+	vargs := []string{"testhost", "status", "--services-file=" + file}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if service.action != "status" || len(service.names) != 1 || service.names[0] != "nginx" {
+		t.Error("Expected status of nginx, got ", service.action, service.names)
+	}
+}
+
+// test the exit code of a stopped service's status
+func TestExitCode01(t *testing.T) {
+	// given
+	service := Service{action: "status"}
+	result := Result{Records: []Record{{State: "started"}, {State: "stopped"}}}
+
+	// when
+	code := exitCode(service, result, nil)
+
+	// then
+	if code != ExitStopped {
+		t.Error("Expected ", ExitStopped, ", got ", code)
+	}
+}
+
+// test the exit code of a missing service's status
+func TestExitCode02(t *testing.T) {
+	// given
+	service := Service{action: "status"}
+	result := Result{Records: []Record{{State: "not found"}, {State: "stopped"}}}
+
+	// when
+	code := exitCode(service, result, nil)
+
+	// then
+	if code != ExitNotFound {
+		t.Error("Expected ", ExitNotFound, ", got ", code)
+	}
+}
+
+// test the exit code of a change made by ensure-started
+func TestExitCode03(t *testing.T) {
+	// given
+	service := Service{action: "ensure-started"}
+	result := Result{Changed: true, Records: []Record{{State: "started"}}}
+
+	// when
+	code := exitCode(service, result, nil)
+
+	// then
+	if code != ExitChanged {
+		t.Error("Expected ", ExitChanged, ", got ", code)
+	}
+}
+
+// test the exit codes of failures
+func TestExitCode04(t *testing.T) {
+	// given
+	errs := map[error]int{
+		fmt.Errorf("service myservice is stopping, expected stopped: %w after 5m0s (300 status checks)", ErrTimeout): ExitTimeout,
+		&CommandError{Kind: ErrAuthFailed, Detail: "ssh: unable to authenticate"}:                                    ExitAuthFailed,
+		&CommandError{Kind: ErrSudoRejected, Detail: "Sorry, try again."}:                                            ExitAuthFailed,
+		&CommandError{Kind: ErrUnreachable, Detail: "dial tcp 10.0.0.1:22: connect: connection refused"}:             ExitUnreachable,
+		&CommandError{Kind: ErrPermissionDenied, Detail: "[SC] OpenService FAILED 5:"}:                               ExitPermission,
+		fmt.Errorf("%w: myservice", ErrServiceNotFound):                                                              ExitNotFound,
+		fmt.Errorf("something went wrong"):                                                                           ExitError,
+	}
+
+	for err, expected := range errs {
+		// when
+		code := exitCode(Service{action: "start"}, Result{}, err)
+
+		// then
+		if code != expected {
+			t.Error("Expected ", expected, " for ", err, ", got ", code)
+		}
+	}
+}
+
+// test a template replaces the output
+func TestUsage25(t *testing.T) {
+	// given
+	vargs := []string{"--format={{.Service}} {{.State}}", "testhost", "list"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if service.output != TemplateOutput || service.format != "{{.Service}} {{.State}}" {
+		t.Error("Expected the template output, got ", service.output, service.format)
+	}
+}
+
+// test correct CHECK parameters entered
+func TestUsage26(t *testing.T) {
+	// given
+	vargs := []string{"--warn-uptime=10m", "--crit-uptime=1m", "testhost", "servicename", "check"}
+
+	// when
+	service, err := usage(vargs, false)
+
+	// then
+	if err != nil {
+		t.Error("Expected NO Errors, got ", err)
+	}
+
+	if service.action != "check" || service.expect != "started" {
+		t.Error("Expected check for started, got ", service.action, service.expect)
+	}
+
+	if service.warnUptime != 10*time.Minute || service.critUptime != time.Minute {
+		t.Error("Expected 10m and 1m, got ", service.warnUptime, service.critUptime)
+	}
+}
+
+// test the dependents stopped are started again when the restart cannot go on
+func TestRestartWithDependents02(t *testing.T) {
+	// given
+	refused := &CommandError{Kind: ErrPermissionDenied, Detail: "myapp: Permission denied"}
+	mock := MockProtocolHandler{
+		results: [20]string{
+			"$network $remote_fs",
+			"/etc/init.d/myapp",
+			"myapp is running",
+			"myapp: Permission denied",
+			"myapp is running",
+			"",
+			"",
+			"myapp is running"},
+		errors: [20]error{3: refused}}
+
+	service := Service{name: "myname", action: "restart", withDependents: true}
+
+	// when
+	_, err := restart(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Error("Expected ErrPermissionDenied, got ", err)
+	}
+
+	for _, run := range mock.runs {
+		if run == "sudo service myname restart" {
+			t.Error("Expected no restart, got ", mock.runs)
+		}
+	}
+
+	if mock.runs[6] != "sudo service myapp start" {
+		t.Error("Expected myapp to be started again, got ", mock.runs)
+	}
+}
+
+// test the dependents that could not be started again are reported
+func TestRestartWithDependents03(t *testing.T) {
+	// given
+	refused := &CommandError{Kind: ErrPermissionDenied, Detail: "myapp: Permission denied"}
+	mock := MockProtocolHandler{
+		results: [20]string{
+			"$network $remote_fs",
+			"/etc/init.d/myapp",
+			"myapp is running",
+			"",
+			"myapp is stopped",
+			"myname is running",
+			"",
+			"myname is running",
+			"myapp: Permission denied",
+			"myapp is stopped"},
+		errors: [20]error{8: refused}}
+
+	service := Service{name: "myname", action: "restart", withDependents: true}
+
+	// when
+	state, err := restart(service, &ServiceExecServiceHandler{}, &mock)
+
+	// then
+	if state.Status != ServiceStatusStarted {
+		t.Error("Expected service started, got ", state)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "dependent services not started again: myapp (service myapp is stopped, expected started: permission denied: myapp: Permission denied)") {
+		t.Error("Expected myapp to be reported, got ", err)
+	}
+}
+
+// test a state that does not exist fails before connecting
+func TestUsage27(t *testing.T) {
+	// given
+	vargs := []string{"--state=running", "testhost", "list"}
+
+	// when
+	_, err := usage(vargs, false)
+
+	// then
+	if err == nil || err.Error() != "invalid --state: running" {
+		t.Error("Expected invalid --state, got ", err)
+	}
+}
+
+// an unknown output fails before connecting
+func TestUsage28(t *testing.T) {
+	// given
+	vargs := []string{"--output=xml", "testhost", "myservice", "status"}
+
+	// when
+	_, err := usage(vargs, false)
+
+	// then
+	if err == nil || err.Error() != "unknown output xml, use text, table, json, yaml, csv" {
+		t.Error("Expected unknown output, got ", err)
+	}
+}
+
+// logs has no structured output
+func TestUsage29(t *testing.T) {
+	// given
+	vargs := []string{"--output=json", "testhost", "myservice", "logs"}
+
+	// when
+	_, err := usage(vargs, false)
+
+	// then
+	if err == nil {
+		t.Error("Expected logs to refuse json")
+	}
+}
+
+// a template that cannot be parsed fails before connecting
+func TestUsage30(t *testing.T) {
+	// given
+	vargs := []string{"--format={{.Service", "testhost", "myservice", "status"}
+
+	// when
+	_, err := usage(vargs, false)
+
+	// then
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid --format: ") {
+		t.Error("Expected invalid --format, got ", err)
+	}
+}
+
+// a template that fails on the records is an error of its own
+func TestPrintRecords01(t *testing.T) {
+	// given
+	service := Service{host: "myhost", name: "myname", action: "status", output: TemplateOutput, format: "{{.Missing}}"}
+	result := Result{Records: []Record{{Service: "myname", State: "started"}}}
+
+	// when
+	err := printRecords(service, result, nil)
+
+	// then
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid --format: ") {
+		t.Error("Expected invalid --format, got ", err)
+	}
+}
+
+// an invalid --timeout fails before connecting instead of not waiting at all
+func TestUsage31(t *testing.T) {
+	// given
+	vargs := []string{"--timeout=5x", "testhost", "myservice", "wait-for", "started"}
+
+	// when
+	_, err := usage(vargs, false)
+
+	// then
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid --timeout: ") {
+		t.Error("Expected invalid --timeout, got ", err)
+	}
+}
+
+// invalid check arguments fail before connecting instead of checking something else
+func TestUsage32(t *testing.T) {
+	// given
+	args := map[string]string{
+		"--expect=runing":   "invalid --expect: runing",
+		"--warn-uptime=10":  "invalid --warn-uptime: ",
+		"--crit-uptime=1 m": "invalid --crit-uptime: ",
+	}
+
+	for arg, expected := range args {
+		vargs := []string{arg, "testhost", "servicename", "check"}
+
+		// when
+		service, err := usage(vargs, false)
+
+		// then
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Error("Expected ", expected, ", got ", err)
+		}
+
+		if service.action != "check" {
+			t.Error("Expected check, got ", service.action)
+		}
+	}
+}
+
+// without --lines a failed action attaches fewer log lines than logs shows
+func TestUsage33(t *testing.T) {
+	// given
+	start := []string{"testhost", "servicename", "start"}
+	logs := []string{"testhost", "servicename", "logs"}
+
+	// when
+	service1, err1 := usage(start, false)
+	service2, err2 := usage(logs, false)
+
+	// then
+	if err1 != nil || err2 != nil {
+		t.Error("Expected NO Errors, got ", err1, err2)
+	}
+
+	if service1.lines != 0 {
+		t.Error("Expected no lines for start, got ", service1.lines)
+	}
+
+	if service2.lines != DefaultLogLines {
+		t.Error("Expected ", DefaultLogLines, " lines for logs, got ", service2.lines)
+	}
+}